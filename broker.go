@@ -0,0 +1,175 @@
+package hub
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Broker owns a Hub's run loop and upgrades incoming HTTP requests to
+// WebSocket connections registered with that Hub.
+type Broker struct {
+	Hub
+
+	allowedOrigins []string
+	upgrader       websocket.Upgrader
+}
+
+// BrokerOption configures a Broker at construction time.
+type BrokerOption func(*Broker)
+
+// WithNotifier registers n to receive hub lifecycle events by name. It's
+// adapted into an EventHook internally; WithEventHook is preferred for new
+// integrations that want the typed callbacks directly.
+func WithNotifier(n Notifier) BrokerOption {
+	return func(b *Broker) {
+		b.hook = &notifierHook{n: n}
+	}
+}
+
+// WithEventHook registers hook to receive typed hub lifecycle events, e.g.
+// a PrometheusCollector. Only one hook (or Notifier) may be registered; the
+// option applied last wins.
+func WithEventHook(hook EventHook) BrokerOption {
+	return func(b *Broker) {
+		b.hook = hook
+	}
+}
+
+// WithHistoryStore overrides the default in-memory HistoryStore, e.g. with
+// a BoltHistoryStore so replay survives a restart.
+func WithHistoryStore(store HistoryStore) BrokerOption {
+	return func(b *Broker) {
+		b.history = store
+	}
+}
+
+// WithTransport overrides the default no-op LocalTransport, e.g. with a
+// NATSTransport or HTTPTransport so multiple websocket-hub processes share
+// a logical topic space.
+func WithTransport(t Transport) BrokerOption {
+	return func(b *Broker) {
+		b.transport = t
+	}
+}
+
+// WithDeliveryPolicy overrides the default AtLeastOnce redelivery tuning
+// (max attempts and backoff) and dead-letter callback. It governs every
+// subscription made with QoS AtLeastOnce; it has no effect on AtMostOnce or
+// DropOldest subscriptions.
+func WithDeliveryPolicy(p DeliveryPolicy) BrokerOption {
+	return func(b *Broker) {
+		b.deliveryPolicy = p
+	}
+}
+
+// WithDefaultTTL sets how long a topic may go without a publish before the
+// janitor reclaims it. It applies to every topic unless a given publish's
+// X-Topic-TTL header overrides it. The zero value, the default, means
+// topics never expire.
+func WithDefaultTTL(d time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.defaultTTL = d
+	}
+}
+
+// NewBroker creates a Broker whose Hub is ready to run. allowedOrigins is
+// checked against the WebSocket handshake's Origin header; pass []string{"*"}
+// to allow any origin.
+func NewBroker(allowedOrigins []string, opts ...BrokerOption) *Broker {
+	b := &Broker{
+		Hub: Hub{
+			clients:         make(map[*Client]bool),
+			topics:          make(map[string][]*Client),
+			register:        make(chan *Client),
+			unregister:      make(chan *Client),
+			subscribe:       make(chan *Subscription),
+			emit:            make(chan PublishMessage),
+			history:         NewMemoryHistoryStore(defaultHistoryCapacity),
+			transport:       NewLocalTransport(),
+			transportSubs:   make(map[string]Unsub),
+			topicMeta:       make(map[string]*topicMeta),
+			wildcardTrie:    NewFilterTrie(),
+			wildcardClients: make(map[string][]*Client),
+			deliveryPolicy:  defaultDeliveryPolicy,
+		},
+		allowedOrigins: allowedOrigins,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	b.upgrader = websocket.Upgrader{
+		CheckOrigin: b.checkOrigin,
+	}
+
+	return b
+}
+
+func (b *Broker) checkOrigin(r *http.Request) bool {
+	for _, o := range b.allowedOrigins {
+		if o == "*" {
+			return true
+		}
+		if o == r.Header.Get("Origin") {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and registers a
+// new Client with the hub.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := b.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	client := &Client{
+		ID:   r.Header.Get("X-User-ID"),
+		conn: conn,
+		send: make(chan []byte, 256),
+		hub:  &b.Hub,
+	}
+
+	b.register <- client
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// Listener is a non-WebSocket subscriber, used by bridges (e.g. the mqtt
+// package) that need to receive Hub frames without a *websocket.Conn.
+type Listener struct {
+	client *Client
+	hub    *Hub
+}
+
+// Listen registers a Listener for topic, which may contain MQTT-style
+// "+"/"#" wildcards. Callers must call Close when done to free the
+// underlying client.
+func (b *Broker) Listen(topic string) *Listener {
+	client := &Client{
+		ID:   "listener-" + newEventID(),
+		send: make(chan []byte, 256),
+		hub:  &b.Hub,
+	}
+
+	b.register <- client
+	b.subscribe <- &Subscription{Client: client, Topic: topic}
+
+	return &Listener{client: client, hub: &b.Hub}
+}
+
+// Frames returns the channel of raw Frame JSON delivered to this listener.
+func (l *Listener) Frames() <-chan []byte {
+	return l.client.send
+}
+
+// Close unregisters the listener from its hub.
+func (l *Listener) Close() {
+	l.hub.unregister <- l.client
+}
@@ -0,0 +1,211 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+)
+
+// Client is a single WebSocket connection registered with a Hub.
+type Client struct {
+	// ID identifies the client across reconnects, e.g. an authenticated user ID.
+	ID string
+
+	// Topics lists the topics this client is currently subscribed to.
+	Topics []string
+
+	conn   *websocket.Conn
+	hub    *Hub
+	send   chan []byte
+	closed bool
+
+	// qos records the QoS each subscribed topic was requested with, so
+	// doEmit knows how to handle a full send buffer for this client.
+	qosMu sync.Mutex
+	qos   map[string]QoS
+
+	// pending holds AtLeastOnce deliveries awaiting an ack, keyed by
+	// Frame ID.
+	pendingMu sync.Mutex
+	pending   map[string]*pendingDelivery
+}
+
+// clientMessage is the envelope clients send over the wire to manage
+// subscriptions and acknowledge AtLeastOnce deliveries.
+type clientMessage struct {
+	Type        string `json:"type"`
+	Topic       string `json:"topic"`
+	LastEventID string `json:"lastEventId"`
+	QoS         QoS    `json:"qos"`
+	ID          string `json:"id"`
+}
+
+// close marks the client as closed, releases its send channel, and cancels
+// any outstanding AtLeastOnce redelivery timers so a late-firing one can't
+// land on a closed send channel (see redeliver in delivery.go, which checks
+// c.closed under the same pendingMu before sending). It is safe to call
+// more than once.
+func (c *Client) close() {
+	c.pendingMu.Lock()
+	if c.closed {
+		c.pendingMu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.send)
+
+	for _, p := range c.pending {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+	}
+	dropped := len(c.pending)
+	c.pending = nil
+	c.pendingMu.Unlock()
+
+	if c.hub != nil && dropped > 0 {
+		atomic.AddInt64(&c.hub.pendingCount, -int64(dropped))
+	}
+}
+
+// readPump reads subscribe requests off the WebSocket connection and
+// forwards them to the hub until the connection is closed.
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, raw, err := c.conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		var msg clientMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case "subscribe":
+			c.hub.subscribe <- &Subscription{
+				Client:      c,
+				Topic:       msg.Topic,
+				LastEventID: msg.LastEventID,
+				QoS:         msg.QoS,
+			}
+		case "ack":
+			c.ack(msg.ID)
+		}
+	}
+}
+
+// writePump relays messages queued on send to the WebSocket connection and
+// keeps the connection alive with periodic pings.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				log.Printf("hub: write to client %s failed: %v", c.ID, err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Subscription requests that Client start receiving messages published on
+// Topic. If LastEventID is set (the event ID from a prior Frame, an
+// SSE/Mercure-style resume token), the hub replays everything the topic's
+// HistoryStore retains after it before the subscription goes live. QoS
+// selects how doEmit handles a full send buffer for this topic; the zero
+// value, AtMostOnce, matches the hub's original drop-and-disconnect behavior.
+type Subscription struct {
+	Client      *Client
+	Topic       string
+	LastEventID string
+	QoS         QoS
+}
+
+// setQoS records the QoS a topic was subscribed with.
+func (c *Client) setQoS(topic string, q QoS) {
+	c.qosMu.Lock()
+	if c.qos == nil {
+		c.qos = make(map[string]QoS)
+	}
+	c.qos[topic] = q
+	c.qosMu.Unlock()
+}
+
+// qosFor returns the QoS topic was subscribed with, or AtMostOnce if it was
+// never set.
+func (c *Client) qosFor(topic string) QoS {
+	c.qosMu.Lock()
+	defer c.qosMu.Unlock()
+	return c.qos[topic]
+}
+
+// trackPending records an AtLeastOnce delivery awaiting an ack.
+func (c *Client) trackPending(id, topic string, entry HistoryEntry, frame []byte) {
+	c.pendingMu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[string]*pendingDelivery)
+	}
+	c.pending[id] = &pendingDelivery{topic: topic, entry: entry, frame: frame, attempts: 1}
+	c.pendingMu.Unlock()
+}
+
+// ack marks id delivered, canceling any scheduled redelivery.
+func (c *Client) ack(id string) {
+	c.pendingMu.Lock()
+	p, ok := c.pending[id]
+	if ok {
+		delete(c.pending, id)
+	}
+	c.pendingMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if c.hub != nil {
+		atomic.AddInt64(&c.hub.pendingCount, -1)
+	}
+}
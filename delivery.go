@@ -0,0 +1,197 @@
+package hub
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// QoS selects how a subscription's deliveries are handled when a client's
+// send buffer can't keep up.
+type QoS int
+
+const (
+	// AtMostOnce drops the message and disconnects the client if send is
+	// full. This is the hub's original behavior and the zero value, so
+	// subscriptions that don't set QoS are unaffected.
+	AtMostOnce QoS = iota
+
+	// AtLeastOnce holds the message in a per-client pending queue, keyed
+	// by its Frame ID, until the client acks it with
+	// {"type":"ack","id":...}. Unacked messages are redelivered with
+	// exponential backoff until DeliveryPolicy.MaxAttempts is reached, at
+	// which point they're handed to DeliveryPolicy.OnDeadLetter.
+	AtLeastOnce
+
+	// DropOldest evicts the oldest queued message to make room instead of
+	// disconnecting the client.
+	DropOldest
+)
+
+// DeliveryPolicy tunes AtLeastOnce redelivery hub-wide; the per-subscription
+// QoS picks which subscriptions it governs.
+type DeliveryPolicy struct {
+	// MaxAttempts is how many times a message is (re)delivered before it's
+	// dead-lettered.
+	MaxAttempts int
+
+	// BaseBackoff is the delay before the first redelivery attempt; each
+	// later attempt doubles it, up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// OnDeadLetter, if set, is called with a message that exhausted
+	// MaxAttempts without being acked.
+	OnDeadLetter func(clientID string, entry HistoryEntry)
+}
+
+// defaultDeliveryPolicy is used by NewBroker until overridden with
+// WithDeliveryPolicy.
+var defaultDeliveryPolicy = DeliveryPolicy{
+	MaxAttempts: 5,
+	BaseBackoff: time.Second,
+	MaxBackoff:  30 * time.Second,
+}
+
+// DeliveryMetrics snapshots AtLeastOnce bookkeeping so operators can tune
+// client buffer sizes instead of discovering drops after the fact.
+type DeliveryMetrics struct {
+	Pending      int64
+	Redelivered  int64
+	DeadLettered int64
+}
+
+// DeliveryMetrics returns a snapshot of the hub's AtLeastOnce counters.
+func (h *Hub) DeliveryMetrics() DeliveryMetrics {
+	return DeliveryMetrics{
+		Pending:      atomic.LoadInt64(&h.pendingCount),
+		Redelivered:  atomic.LoadInt64(&h.redeliveredCount),
+		DeadLettered: atomic.LoadInt64(&h.deadLetteredCount),
+	}
+}
+
+// pendingDelivery tracks one unacked AtLeastOnce message on a Client.
+type pendingDelivery struct {
+	topic    string
+	entry    HistoryEntry
+	frame    []byte
+	attempts int
+	timer    *time.Timer
+}
+
+// deliverToClient sends frame to c according to topic's QoS, handling
+// AtLeastOnce tracking and DropOldest eviction. It never blocks, preserving
+// Run's single-goroutine invariant. It reports whether frame ended up in
+// c.send, for EventHook.OnPublish's delivered/dropped counts.
+func (h *Hub) deliverToClient(c *Client, topic string, entry HistoryEntry, frame []byte) bool {
+	switch c.qosFor(topic) {
+	case DropOldest:
+		return sendDropOldest(c, frame)
+	case AtLeastOnce:
+		return h.sendAtLeastOnce(c, topic, entry, frame)
+	default:
+		select {
+		case c.send <- frame:
+			return true
+		default:
+			h.doUnregisterReason(c, ReasonSlowConsumer)
+			return false
+		}
+	}
+}
+
+// sendDropOldest makes room for frame by discarding the head of c.send if
+// it's full, rather than disconnecting c.
+func sendDropOldest(c *Client, frame []byte) bool {
+	select {
+	case c.send <- frame:
+		return true
+	default:
+	}
+
+	select {
+	case <-c.send:
+	default:
+	}
+
+	select {
+	case c.send <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *Hub) sendAtLeastOnce(c *Client, topic string, entry HistoryEntry, frame []byte) bool {
+	select {
+	case c.send <- frame:
+	default:
+		h.doUnregisterReason(c, ReasonSlowConsumer)
+		return false
+	}
+
+	c.trackPending(entry.ID, topic, entry, frame)
+	atomic.AddInt64(&h.pendingCount, 1)
+	h.scheduleRedelivery(c, entry.ID)
+	return true
+}
+
+func (h *Hub) scheduleRedelivery(c *Client, id string) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	p, ok := c.pending[id]
+	if !ok {
+		return
+	}
+
+	backoff := h.deliveryPolicy.BaseBackoff * time.Duration(int64(1)<<uint(p.attempts-1))
+	if backoff > h.deliveryPolicy.MaxBackoff {
+		backoff = h.deliveryPolicy.MaxBackoff
+	}
+
+	// p.timer is written here under pendingMu, the same lock close() takes
+	// before reading it to Stop() outstanding timers, so the two can't race
+	// even when this runs from redeliver's own timer goroutine rather than
+	// Run's single-goroutine loop.
+	p.timer = time.AfterFunc(backoff, func() { h.redeliver(c, id) })
+}
+
+// redeliver runs on its own timer goroutine (see scheduleRedelivery), so
+// unlike the rest of this file it isn't serialized through Run. It holds
+// pendingMu across the send itself, not just the pending lookup, so it
+// can't race with Client.close: whichever of the two takes the lock first
+// either sends on a still-open channel or finds the client already closed
+// and its pending entries gone.
+func (h *Hub) redeliver(c *Client, id string) {
+	c.pendingMu.Lock()
+
+	p, ok := c.pending[id]
+	if !ok || c.closed {
+		c.pendingMu.Unlock()
+		return
+	}
+
+	if p.attempts >= h.deliveryPolicy.MaxAttempts {
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+
+		atomic.AddInt64(&h.pendingCount, -1)
+		atomic.AddInt64(&h.deadLetteredCount, 1)
+		if h.deliveryPolicy.OnDeadLetter != nil {
+			h.deliveryPolicy.OnDeadLetter(c.ID, p.entry)
+		}
+		return
+	}
+
+	p.attempts++
+	frame := p.frame
+
+	select {
+	case c.send <- frame:
+		atomic.AddInt64(&h.redeliveredCount, 1)
+	default:
+	}
+	c.pendingMu.Unlock()
+
+	h.scheduleRedelivery(c, id)
+}
@@ -0,0 +1,110 @@
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelivery_DropOldest(t *testing.T) {
+	t.Run("evicts the head of send instead of disconnecting", func(t *testing.T) {
+		broker := NewBroker([]string{"*"})
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 1)}
+		mustRegister(broker, client, t)
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "FAKETOPIC", QoS: DropOldest}, t)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("first")})
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("second")})
+
+		if got, want := getEmitMsg(client.send), "second"; got != want {
+			t.Fatalf("got %s want %s", got, want)
+		}
+
+		if _, ok := broker.Hub.clients[client]; !ok {
+			t.Fatal("DropOldest should not disconnect the client")
+		}
+	})
+}
+
+func TestDelivery_AtLeastOnce(t *testing.T) {
+	t.Run("ack cancels the pending redelivery", func(t *testing.T) {
+		broker := NewBroker([]string{"*"})
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 1)}
+		mustRegister(broker, client, t)
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "FAKETOPIC", QoS: AtLeastOnce}, t)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("payload")})
+		frame := decodeFrame(t, <-client.send)
+
+		if got := broker.Hub.DeliveryMetrics().Pending; got != 1 {
+			t.Fatalf("Pending = %d, want 1", got)
+		}
+
+		client.ack(frame.ID)
+
+		if got := broker.Hub.DeliveryMetrics().Pending; got != 0 {
+			t.Fatalf("Pending after ack = %d, want 0", got)
+		}
+	})
+
+	t.Run("exhausting MaxAttempts dead-letters the message", func(t *testing.T) {
+		broker := NewBroker([]string{"*"}, WithDeliveryPolicy(DeliveryPolicy{
+			MaxAttempts: 1,
+			// Long enough that the real redelivery timer never fires during
+			// the test; redeliver is driven directly below instead.
+			BaseBackoff: time.Hour,
+			MaxBackoff:  time.Hour,
+		}))
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 1)}
+		mustRegister(broker, client, t)
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "FAKETOPIC", QoS: AtLeastOnce}, t)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("payload")})
+		frame := decodeFrame(t, <-client.send)
+
+		deadLettered := make(chan HistoryEntry, 1)
+		broker.Hub.deliveryPolicy.OnDeadLetter = func(clientID string, entry HistoryEntry) {
+			deadLettered <- entry
+		}
+
+		// Drives the redelivery attempt directly instead of waiting on the
+		// real backoff timer, so the test doesn't depend on wall-clock time.
+		broker.Hub.redeliver(client, frame.ID)
+
+		select {
+		case entry := <-deadLettered:
+			if string(entry.Payload) != "payload" {
+				t.Fatalf("dead-lettered payload = %s, want payload", entry.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("OnDeadLetter was never called")
+		}
+
+		if got := broker.Hub.DeliveryMetrics().DeadLettered; got != 1 {
+			t.Fatalf("DeadLettered = %d, want 1", got)
+		}
+	})
+}
+
+// TestDelivery_RedeliverAfterClose is a regression test: a redelivery timer
+// firing after the client has already disconnected must not send on the
+// now-closed send channel.
+func TestDelivery_RedeliverAfterClose(t *testing.T) {
+	broker := NewBroker([]string{"*"})
+	client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 1)}
+	mustRegister(broker, client, t)
+	mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "FAKETOPIC", QoS: AtLeastOnce}, t)
+
+	broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("payload")})
+	frame := decodeFrame(t, <-client.send)
+
+	broker.Hub.doUnregister(client)
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("redeliver panicked after client close: %v", r)
+		}
+	}()
+
+	// Simulates a scheduleRedelivery timer firing after close.
+	broker.Hub.redeliver(client, frame.ID)
+}
@@ -0,0 +1,59 @@
+package hub
+
+import "time"
+
+// DisconnectReason explains why OnUnregister fired.
+type DisconnectReason string
+
+const (
+	// ReasonClientClosed is used for a normal unregister: the client's
+	// connection closed, or a Listener was explicitly closed.
+	ReasonClientClosed DisconnectReason = "client_closed"
+
+	// ReasonSlowConsumer is used when the hub disconnected the client
+	// itself because its send buffer was full under QoS AtMostOnce or
+	// AtLeastOnce.
+	ReasonSlowConsumer DisconnectReason = "slow_consumer"
+)
+
+// EventHook receives typed hub lifecycle events. It supersedes Notifier's
+// single stringly-typed Notify, giving callers like the built-in
+// PrometheusCollector enough detail to turn each event directly into a
+// metric. WithEventHook installs one on a Broker; WithNotifier wraps a
+// legacy Notifier in a thin adapter so existing integrations keep working
+// unchanged.
+type EventHook interface {
+	// OnRegister fires after a new client is registered with the hub.
+	OnRegister(c *Client)
+
+	// OnSubscribe fires after a subscription is recorded, whether its
+	// Topic is a plain topic or an MQTT-style wildcard filter.
+	OnSubscribe(s *Subscription)
+
+	// OnPublish fires once a message has been fanned out to every
+	// subscriber. delivered and dropped count the clients whose send
+	// buffer did and didn't accept the frame; elapsed is how long the
+	// fan-out took, for a publish-latency histogram.
+	OnPublish(msg PublishMessage, delivered, dropped int, elapsed time.Duration)
+
+	// OnUnregister fires after a client is removed from the hub, with the
+	// reason it was disconnected.
+	OnUnregister(c *Client, reason DisconnectReason)
+}
+
+// notifierHook adapts a Notifier to EventHook, so WithNotifier keeps
+// working for callers that haven't moved to the typed callbacks.
+type notifierHook struct {
+	n Notifier
+}
+
+func (h *notifierHook) OnRegister(c *Client)        { h.n.Notify("register") }
+func (h *notifierHook) OnSubscribe(s *Subscription) { h.n.Notify("subscribe") }
+
+func (h *notifierHook) OnPublish(msg PublishMessage, delivered, dropped int, elapsed time.Duration) {
+	h.n.Notify("publish")
+}
+
+func (h *notifierHook) OnUnregister(c *Client, reason DisconnectReason) {
+	h.n.Notify("unregister")
+}
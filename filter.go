@@ -0,0 +1,118 @@
+package hub
+
+import "strings"
+
+// hasWildcard reports whether topic contains an MQTT-style wildcard
+// segment ("+" or "#").
+func hasWildcard(topic string) bool {
+	return strings.ContainsAny(topic, "+#")
+}
+
+// MatchTopic reports whether topic matches filter using MQTT 3.1.1/5.0
+// wildcard rules: "+" matches exactly one topic level, and a trailing "#"
+// matches that level and every level beneath it.
+func MatchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
+
+// FilterTrie indexes a set of MQTT-style topic filters (each possibly
+// containing "+"/"#" wildcards), keyed by their "/"-separated levels, so a
+// publish can find every matching filter without scanning the whole set.
+// It's used by the mqtt bridge to fan PUBLISHes out to matching sessions,
+// and by Hub to fan emits out to WebSocket subscriptions whose Topic
+// contains a wildcard.
+type FilterTrie struct {
+	root *filterNode
+}
+
+type filterNode struct {
+	children map[string]*filterNode
+	filters  map[string]bool
+}
+
+func newFilterNode() *filterNode {
+	return &filterNode{
+		children: make(map[string]*filterNode),
+		filters:  make(map[string]bool),
+	}
+}
+
+// NewFilterTrie creates an empty FilterTrie.
+func NewFilterTrie() *FilterTrie {
+	return &FilterTrie{root: newFilterNode()}
+}
+
+// Add indexes filter.
+func (t *FilterTrie) Add(filter string) {
+	node := t.root
+	for _, level := range strings.Split(filter, "/") {
+		child, ok := node.children[level]
+		if !ok {
+			child = newFilterNode()
+			node.children[level] = child
+		}
+		node = child
+	}
+	node.filters[filter] = true
+}
+
+// Remove un-indexes filter.
+func (t *FilterTrie) Remove(filter string) {
+	node := t.root
+	for _, level := range strings.Split(filter, "/") {
+		child, ok := node.children[level]
+		if !ok {
+			return
+		}
+		node = child
+	}
+	delete(node.filters, filter)
+}
+
+// Match returns every indexed filter that matches topic.
+func (t *FilterTrie) Match(topic string) []string {
+	var matches []string
+	t.match(t.root, strings.Split(topic, "/"), &matches)
+	return matches
+}
+
+func (t *FilterTrie) match(node *filterNode, levels []string, matches *[]string) {
+	if hashNode, ok := node.children["#"]; ok {
+		for f := range hashNode.filters {
+			*matches = append(*matches, f)
+		}
+	}
+
+	if len(levels) == 0 {
+		for f := range node.filters {
+			*matches = append(*matches, f)
+		}
+		return
+	}
+
+	level, rest := levels[0], levels[1:]
+
+	if child, ok := node.children[level]; ok {
+		t.match(child, rest, matches)
+	}
+	if level != "+" {
+		if child, ok := node.children["+"]; ok {
+			t.match(child, rest, matches)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package hub
+
+import (
+	"errors"
+	"sync"
+)
+
+// defaultHistoryCapacity bounds the in-memory ring buffer NewBroker
+// installs when no HistoryStore is supplied via WithHistoryStore.
+const defaultHistoryCapacity = 100
+
+// ErrUnknownEventID is returned by HistoryStore.Since when lastEventID
+// doesn't match any entry still retained for topic, e.g. because it has
+// aged out of the store.
+var ErrUnknownEventID = errors.New("hub: unknown event id")
+
+// HistoryEntry is one message recorded for a topic, in publish order.
+type HistoryEntry struct {
+	ID      string
+	Seq     uint64
+	Topic   string
+	Payload []byte
+}
+
+// HistoryStore records published messages per topic so that subscribers
+// can replay what they missed on resubscribe. Implementations must be
+// safe for concurrent use.
+type HistoryStore interface {
+	// Append records payload as the next message on topic and returns the
+	// entry it was assigned, including a monotonically increasing Seq and
+	// a unique event ID.
+	Append(topic string, payload []byte) (HistoryEntry, error)
+
+	// Since returns every entry recorded on topic strictly after
+	// lastEventID, oldest first. An empty lastEventID returns the entire
+	// retained history for topic.
+	Since(topic, lastEventID string) ([]HistoryEntry, error)
+}
+
+// MemoryHistoryStore is a HistoryStore backed by a fixed-size, per-topic
+// ring buffer. It's the default store and is suitable for a single
+// process; history does not survive a restart.
+type MemoryHistoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string][]HistoryEntry
+	seq      map[string]uint64
+}
+
+// NewMemoryHistoryStore creates a MemoryHistoryStore that retains up to
+// capacity entries per topic.
+func NewMemoryHistoryStore(capacity int) *MemoryHistoryStore {
+	return &MemoryHistoryStore{
+		capacity: capacity,
+		entries:  make(map[string][]HistoryEntry),
+		seq:      make(map[string]uint64),
+	}
+}
+
+// Append implements HistoryStore.
+func (m *MemoryHistoryStore) Append(topic string, payload []byte) (HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq[topic]++
+	entry := HistoryEntry{
+		ID:      newEventID(),
+		Seq:     m.seq[topic],
+		Topic:   topic,
+		Payload: payload,
+	}
+
+	ring := append(m.entries[topic], entry)
+	if len(ring) > m.capacity {
+		ring = ring[len(ring)-m.capacity:]
+	}
+	m.entries[topic] = ring
+
+	return entry, nil
+}
+
+// Since implements HistoryStore.
+func (m *MemoryHistoryStore) Since(topic, lastEventID string) ([]HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ring := m.entries[topic]
+	if lastEventID == "" {
+		out := make([]HistoryEntry, len(ring))
+		copy(out, ring)
+		return out, nil
+	}
+
+	for i, e := range ring {
+		if e.ID == lastEventID {
+			out := make([]HistoryEntry, len(ring[i+1:]))
+			copy(out, ring[i+1:])
+			return out, nil
+		}
+	}
+
+	return nil, ErrUnknownEventID
+}
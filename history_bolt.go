@@ -0,0 +1,110 @@
+package hub
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltHistoryStore persists topic history to a BoltDB file, one bucket
+// per topic, so history survives process restarts.
+type BoltHistoryStore struct {
+	db *bolt.DB
+}
+
+// NewBoltHistoryStore opens (creating if necessary) a BoltDB-backed
+// HistoryStore at path.
+func NewBoltHistoryStore(path string) (*BoltHistoryStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("hub: open bolt history store: %w", err)
+	}
+	return &BoltHistoryStore{db: db}, nil
+}
+
+// Close releases the underlying BoltDB file.
+func (s *BoltHistoryStore) Close() error {
+	return s.db.Close()
+}
+
+// Append implements HistoryStore.
+func (s *BoltHistoryStore) Append(topic string, payload []byte) (HistoryEntry, error) {
+	var entry HistoryEntry
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(topic))
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		entry = HistoryEntry{
+			ID:      newEventID(),
+			Seq:     seq,
+			Topic:   topic,
+			Payload: payload,
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(seqKey(seq), data)
+	})
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// Since implements HistoryStore.
+func (s *BoltHistoryStore) Since(topic, lastEventID string) ([]HistoryEntry, error) {
+	var out []HistoryEntry
+	found := lastEventID == ""
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(topic))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(_, data []byte) error {
+			var entry HistoryEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+
+			if found {
+				out = append(out, entry)
+				return nil
+			}
+
+			if entry.ID == lastEventID {
+				found = true
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUnknownEventID
+	}
+
+	return out, nil
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
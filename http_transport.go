@@ -0,0 +1,118 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// httpTransportTimeout bounds how long Publish waits on a single peer.
+// Without it, a peer that accepts the connection but never responds (a
+// partition, not just a refused connection) would hang Publish - and the
+// goroutine Hub.forwardToTransport runs it in - indefinitely.
+const httpTransportTimeout = 5 * time.Second
+
+// HTTPTransport fans published messages out to a fixed set of peer
+// websocket-hub processes over HTTP, and is itself an http.Handler peers
+// POST back into, so every instance behind a load balancer observes the
+// same publishes. Mount it on each peer at whatever path the others were
+// configured with.
+type HTTPTransport struct {
+	peers  []string
+	client *http.Client
+
+	mu       sync.Mutex
+	handlers map[string]func(payload []byte)
+}
+
+type httpTransportMessage struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+// NewHTTPTransport creates an HTTPTransport that forwards publishes to
+// peers, the base URL each peer mounts its HTTPTransport at.
+func NewHTTPTransport(peers ...string) *HTTPTransport {
+	return &HTTPTransport{
+		peers:    peers,
+		client:   &http.Client{Timeout: httpTransportTimeout},
+		handlers: make(map[string]func(payload []byte)),
+	}
+}
+
+// Connect implements Transport.
+func (t *HTTPTransport) Connect() error { return nil }
+
+// Disconnect implements Transport.
+func (t *HTTPTransport) Disconnect() error { return nil }
+
+// Publish implements Transport.
+func (t *HTTPTransport) Publish(topic string, payload []byte) error {
+	data, err := json.Marshal(httpTransportMessage{Topic: topic, Payload: payload})
+	if err != nil {
+		return err
+	}
+
+	// Fan out to every peer concurrently so one slow or unreachable peer
+	// doesn't make the others wait behind it; httpTransportTimeout still
+	// bounds the total time this call can take.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	wg.Add(len(t.peers))
+	for _, peer := range t.peers {
+		go func(peer string) {
+			defer wg.Done()
+
+			resp, err := t.client.Post(peer, "application/json", bytes.NewReader(data))
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			resp.Body.Close()
+		}(peer)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// Subscribe implements Transport.
+func (t *HTTPTransport) Subscribe(topic string, handler func(payload []byte)) (Unsub, error) {
+	t.mu.Lock()
+	t.handlers[topic] = handler
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		delete(t.handlers, topic)
+		t.mu.Unlock()
+	}, nil
+}
+
+// ServeHTTP accepts a publish forwarded from a peer and dispatches it to
+// the matching local subscription registered via Subscribe.
+func (t *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg httpTransportMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.mu.Lock()
+	handler := t.handlers[msg.Topic]
+	t.mu.Unlock()
+
+	if handler != nil {
+		handler(msg.Payload)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
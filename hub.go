@@ -0,0 +1,459 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Hub tracks connected clients and the topics they're subscribed to, and
+// fans published messages out to subscribers. It is not safe for
+// concurrent use directly; all state changes are serialized through Run by
+// sending on the register/unregister/subscribe/emit channels.
+type Hub struct {
+	clients map[*Client]bool
+	topics  map[string][]*Client
+
+	register   chan *Client
+	unregister chan *Client
+	subscribe  chan *Subscription
+	emit       chan PublishMessage
+
+	hook EventHook
+
+	// history records emitted messages per topic so doSubscribe can
+	// replay what a resubscribing client missed.
+	history HistoryStore
+
+	// transport forwards locally-published messages to other
+	// websocket-hub processes and re-enters their publishes via emit.
+	transport Transport
+
+	transportMu   sync.Mutex
+	transportSubs map[string]Unsub
+
+	// defaultTTL is applied to a topic on first publish unless a
+	// per-publish TTL header overrides it. Zero means topics never expire.
+	defaultTTL time.Duration
+
+	topicMu   sync.Mutex
+	topicMeta map[string]*topicMeta
+
+	// wildcardMu guards wildcardTrie and wildcardClients, which together
+	// track subscriptions whose Topic contains an MQTT-style "+"/"#"
+	// wildcard. Plain subscriptions never touch these and keep using the
+	// exact-match topics map above.
+	wildcardMu      sync.Mutex
+	wildcardTrie    *FilterTrie
+	wildcardClients map[string][]*Client
+
+	// deliveryPolicy tunes AtLeastOnce redelivery; see delivery.go.
+	deliveryPolicy DeliveryPolicy
+
+	pendingCount      int64
+	redeliveredCount  int64
+	deadLetteredCount int64
+}
+
+// Run processes hub events until the process exits. It is meant to be
+// started once in its own goroutine, e.g. `go broker.Run()`.
+func (h *Hub) Run() {
+	if h.transport != nil {
+		if err := h.transport.Connect(); err != nil {
+			log.Printf("hub: transport connect failed: %v", err)
+		}
+	}
+
+	janitor := time.NewTicker(janitorInterval)
+	defer janitor.Stop()
+
+	for {
+		// A plain `select` over all five channels would pick
+		// pseudo-randomly whenever more than one is ready at once, which
+		// lets it process e.g. unregister before the register it depends
+		// on whenever a burst fills every channel before Run's first
+		// iteration (a slow Connect above is enough to cause this). Drain
+		// channels in dependency order instead - register, then
+		// subscribe, then emit, then unregister - before falling back to
+		// a blocking select across all of them.
+		if h.runOnce(janitor.C) {
+			continue
+		}
+
+		select {
+		case c := <-h.register:
+			h.doRegister(c)
+			if h.hook != nil {
+				h.hook.OnRegister(c)
+			}
+		case s := <-h.subscribe:
+			h.doSubscribe(s)
+			if h.hook != nil {
+				h.hook.OnSubscribe(s)
+			}
+		case msg := <-h.emit:
+			h.runEmit(msg)
+		case c := <-h.unregister:
+			h.doUnregister(c)
+		case now := <-janitor.C:
+			h.expireTopics(now)
+		}
+	}
+}
+
+// runOnce non-blockingly processes at most one already-pending event, in
+// register/subscribe/emit/unregister priority order, and reports whether
+// it handled one. Run calls it before its blocking select so that a burst
+// which fills several channels at once is drained in the order those
+// events depend on each other rather than select's pseudo-random choice.
+//
+// janitorC is checked first, non-blockingly, so a continuously busy hub -
+// where Run's blocking select below is never reached because runOnce
+// always finds one of the other four channels ready - still services the
+// janitor tick instead of leaving it to pile up against time.Ticker's
+// one-tick buffer and get dropped, which would starve expireTopics
+// indefinitely.
+func (h *Hub) runOnce(janitorC <-chan time.Time) bool {
+	select {
+	case now := <-janitorC:
+		h.expireTopics(now)
+		return true
+	default:
+	}
+
+	select {
+	case c := <-h.register:
+		h.doRegister(c)
+		if h.hook != nil {
+			h.hook.OnRegister(c)
+		}
+		return true
+	default:
+	}
+
+	select {
+	case s := <-h.subscribe:
+		h.doSubscribe(s)
+		if h.hook != nil {
+			h.hook.OnSubscribe(s)
+		}
+		return true
+	default:
+	}
+
+	select {
+	case msg := <-h.emit:
+		h.runEmit(msg)
+		return true
+	default:
+	}
+
+	select {
+	case c := <-h.unregister:
+		h.doUnregister(c)
+		return true
+	default:
+	}
+
+	return false
+}
+
+func (h *Hub) runEmit(msg PublishMessage) {
+	start := time.Now()
+	delivered, dropped := h.doEmit(msg)
+	if !msg.fromTransport {
+		h.forwardToTransport(msg)
+	}
+	if h.hook != nil {
+		h.hook.OnPublish(msg, delivered, dropped, time.Since(start))
+	}
+}
+
+// publishAndWait queues msg like Publish, then blocks until Run has
+// assigned it a HistoryEntry and returns it. Used by BrokerServer's HTTP
+// publish endpoint, which must report the assigned message ID.
+func (h *Hub) publishAndWait(msg PublishMessage) HistoryEntry {
+	msg.result = make(chan HistoryEntry, 1)
+	h.emit <- msg
+	return <-msg.result
+}
+
+// forwardToTransport hands msg to the configured Transport in its own
+// goroutine. Transport.Publish (e.g. HTTPTransport's peer fan-out) can take
+// up to its own timeout per call; running it inline here would stall
+// Run's single event loop, and with it every local client's
+// register/subscribe/unregister/emit, on a single slow or unreachable
+// peer.
+func (h *Hub) forwardToTransport(msg PublishMessage) {
+	if h.transport == nil {
+		return
+	}
+	go func() {
+		if err := h.transport.Publish(msg.Topic, msg.Payload); err != nil {
+			log.Printf("hub: transport publish on %s failed: %v", msg.Topic, err)
+		}
+	}()
+}
+
+// Publish queues msg for delivery to every client subscribed to msg.Topic.
+func (h *Hub) Publish(msg PublishMessage) {
+	h.emit <- msg
+}
+
+func (h *Hub) doRegister(c *Client) {
+	c.hub = h
+	h.clients[c] = true
+}
+
+// doUnregister removes c for the ordinary reason: its connection closed, or
+// a Listener was explicitly closed. Call doUnregisterReason directly to
+// report a different reason, e.g. a slow-consumer disconnect.
+func (h *Hub) doUnregister(c *Client) {
+	h.doUnregisterReason(c, ReasonClientClosed)
+}
+
+func (h *Hub) doUnregisterReason(c *Client, reason DisconnectReason) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+
+	delete(h.clients, c)
+	h.deleteTopicClient(c)
+	h.handleEmptyTopics(c)
+	c.close()
+
+	if h.hook != nil {
+		h.hook.OnUnregister(c, reason)
+	}
+}
+
+// doSubscribe replays any history the subscription asks for via
+// LastEventID and then marks the client live for the topic. Both steps run
+// here, inside Run's single-goroutine event loop, so no message can be
+// emitted in the gap between replay and going live, which would otherwise
+// drop it.
+func (h *Hub) doSubscribe(s *Subscription) {
+	if hasWildcard(s.Topic) {
+		h.doSubscribeWildcard(s)
+		return
+	}
+
+	if s.LastEventID != "" && h.history != nil {
+		entries, err := h.history.Since(s.Topic, s.LastEventID)
+		switch {
+		case errors.Is(err, ErrUnknownEventID):
+			// s.LastEventID aged out of the store: there's a gap we can't
+			// fill, so tell the client rather than silently going live as
+			// if replay had succeeded.
+			select {
+			case s.Client.send <- newResyncRequiredFrame(s.Topic):
+			default:
+			}
+		case err != nil:
+			log.Printf("hub: history replay for %s since %s failed: %v", s.Topic, s.LastEventID, err)
+		default:
+		replay:
+			for _, e := range entries {
+				select {
+				case s.Client.send <- newFrame(e):
+				default:
+					// s.Client.send is full: delivering the rest of the
+					// replay would silently skip entries with no way for
+					// the client to know. Treat it the same as an unknown
+					// LastEventID and stop replaying rather than drop the
+					// remainder.
+					select {
+					case s.Client.send <- newResyncRequiredFrame(s.Topic):
+					default:
+					}
+					break replay
+				}
+			}
+		}
+	}
+
+	if _, exists := h.topics[s.Topic]; !exists {
+		h.subscribeTransport(s.Topic)
+	}
+
+	h.topics[s.Topic] = append(h.topics[s.Topic], s.Client)
+	s.Client.setQoS(s.Topic, s.QoS)
+
+	if !containsString(s.Topic, s.Client.Topics) {
+		s.Client.Topics = append(s.Client.Topics, s.Topic)
+	}
+}
+
+// doSubscribeWildcard handles a Subscription whose Topic is an MQTT-style
+// filter ("+"/"#"). Wildcard subscriptions don't get history replay or a
+// transport subscription of their own: they ride on whatever plain topics
+// are already forwarded, matched against msg.Topic in doEmit.
+func (h *Hub) doSubscribeWildcard(s *Subscription) {
+	h.wildcardMu.Lock()
+	defer h.wildcardMu.Unlock()
+
+	if _, exists := h.wildcardClients[s.Topic]; !exists {
+		h.wildcardTrie.Add(s.Topic)
+	}
+
+	h.wildcardClients[s.Topic] = append(h.wildcardClients[s.Topic], s.Client)
+	s.Client.setQoS(s.Topic, s.QoS)
+
+	if !containsString(s.Topic, s.Client.Topics) {
+		s.Client.Topics = append(s.Client.Topics, s.Topic)
+	}
+}
+
+// doEmit records msg against the topic's history and metadata, then
+// delivers it to every currently-subscribed client. Unlike subscriber
+// bookkeeping, this runs even for a topic nobody has subscribed to yet, so
+// a publish-before-subscribe or a long-poll GET /topic/{name} consumer
+// still has something to read. It returns how many subscribers the frame
+// was and wasn't delivered to, for EventHook.OnPublish.
+func (h *Hub) doEmit(msg PublishMessage) (delivered, dropped int) {
+	entry := HistoryEntry{Topic: msg.Topic, Payload: msg.Payload}
+	if h.history != nil {
+		if stored, err := h.history.Append(msg.Topic, msg.Payload); err == nil {
+			entry = stored
+		}
+	}
+
+	h.touchTopicMeta(msg.Topic, msg.ttlOverride, entry.Seq)
+
+	frame := newFrame(entry)
+	for _, c := range h.topics[msg.Topic] {
+		if h.deliverToClient(c, msg.Topic, entry, frame) {
+			delivered++
+		} else {
+			dropped++
+		}
+	}
+
+	wDelivered, wDropped := h.deliverWildcard(msg.Topic, entry, frame)
+	delivered += wDelivered
+	dropped += wDropped
+
+	if msg.result != nil {
+		msg.result <- entry
+	}
+	return delivered, dropped
+}
+
+// deliverWildcard fans frame out to every client whose wildcard
+// subscription filter matches topic, returning how many it was and wasn't
+// delivered to.
+func (h *Hub) deliverWildcard(topic string, entry HistoryEntry, frame []byte) (delivered, dropped int) {
+	type recipient struct {
+		client *Client
+		filter string
+	}
+
+	h.wildcardMu.Lock()
+	var recipients []recipient
+	for _, filter := range h.wildcardTrie.Match(topic) {
+		for _, c := range h.wildcardClients[filter] {
+			recipients = append(recipients, recipient{client: c, filter: filter})
+		}
+	}
+	h.wildcardMu.Unlock()
+
+	for _, r := range recipients {
+		if h.deliverToClient(r.client, r.filter, entry, frame) {
+			delivered++
+		} else {
+			dropped++
+		}
+	}
+	return delivered, dropped
+}
+
+// deleteTopicClient removes c from every topic it's subscribed to, without
+// touching c.Topics.
+func (h *Hub) deleteTopicClient(c *Client) {
+	h.wildcardMu.Lock()
+	defer h.wildcardMu.Unlock()
+
+	for _, topic := range c.Topics {
+		if hasWildcard(topic) {
+			clients := h.wildcardClients[topic]
+			for i, cl := range clients {
+				if cl == c {
+					h.wildcardClients[topic] = append(clients[:i], clients[i+1:]...)
+					break
+				}
+			}
+			continue
+		}
+
+		clients := h.topics[topic]
+		for i, cl := range clients {
+			if cl == c {
+				h.topics[topic] = append(clients[:i], clients[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// handleEmptyTopics removes any of c's former topics from the hub once they
+// have no clients left.
+func (h *Hub) handleEmptyTopics(c *Client) {
+	for _, topic := range c.Topics {
+		if hasWildcard(topic) {
+			h.wildcardMu.Lock()
+			if len(h.wildcardClients[topic]) == 0 {
+				delete(h.wildcardClients, topic)
+				h.wildcardTrie.Remove(topic)
+			}
+			h.wildcardMu.Unlock()
+			continue
+		}
+
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+			h.unsubscribeTransport(topic)
+		}
+	}
+}
+
+// subscribeTransport registers topic with the transport, if one is
+// configured, so publishes from other processes re-enter via emit.
+func (h *Hub) subscribeTransport(topic string) {
+	if h.transport == nil {
+		return
+	}
+
+	unsub, err := h.transport.Subscribe(topic, func(payload []byte) {
+		h.emit <- PublishMessage{Topic: topic, Payload: payload, fromTransport: true}
+	})
+	if err != nil {
+		log.Printf("hub: transport subscribe to %s failed: %v", topic, err)
+		return
+	}
+
+	h.transportMu.Lock()
+	h.transportSubs[topic] = unsub
+	h.transportMu.Unlock()
+}
+
+func (h *Hub) unsubscribeTransport(topic string) {
+	h.transportMu.Lock()
+	unsub, ok := h.transportSubs[topic]
+	delete(h.transportSubs, topic)
+	h.transportMu.Unlock()
+
+	if ok {
+		unsub()
+	}
+}
+
+// getClient finds a registered client by ID.
+func (h *Hub) getClient(id string) (*Client, bool) {
+	for c := range h.clients {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
@@ -1,14 +1,15 @@
 package hub
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
-	"github.com/codegangsta/negroni"
-	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
 
@@ -168,6 +169,235 @@ func TestHub_doEmit(t *testing.T) {
 	})
 }
 
+func TestHub_ExpireTopics(t *testing.T) {
+	t.Run("A topic past its TTL with no subscribers is reclaimed", func(t *testing.T) {
+		broker := NewBroker([]string{"*"}, WithDefaultTTL(time.Minute))
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("one")})
+
+		if _, ok := broker.Hub.topicMeta["FAKETOPIC"]; !ok {
+			t.Fatal("topic metadata missing after publish")
+		}
+
+		broker.Hub.expireTopics(time.Now().Add(2 * time.Minute))
+
+		if _, ok := broker.Hub.topicMeta["FAKETOPIC"]; ok {
+			t.Fatal("topic metadata should have been reclaimed past its TTL")
+		}
+	})
+
+	t.Run("A topic with a live subscriber is retained past its TTL", func(t *testing.T) {
+		broker := NewBroker([]string{"*"}, WithDefaultTTL(time.Minute))
+
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 256)}
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "FAKETOPIC"}, t)
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("one")})
+
+		broker.Hub.expireTopics(time.Now().Add(2 * time.Minute))
+
+		if _, ok := broker.Hub.topicMeta["FAKETOPIC"]; !ok {
+			t.Fatal("topic metadata should be retained while a subscriber remains")
+		}
+		if _, ok := broker.Hub.topics["FAKETOPIC"]; !ok {
+			t.Fatal("topic should be retained while a subscriber remains")
+		}
+	})
+}
+
+func TestHub_DoSubscribe_Replay(t *testing.T) {
+	t.Run("Resubscribing with LastEventID replays missed messages only", func(t *testing.T) {
+		broker := NewBroker([]string{"*"})
+
+		first := &Client{ID: "FIRST", send: make(chan []byte, 256)}
+		mustSubscribe(&broker.Hub, &Subscription{Client: first, Topic: "FAKETOPIC"}, t)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("one")})
+		firstFrame := decodeFrame(t, <-first.send)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("two")})
+		<-first.send
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("three")})
+		<-first.send
+
+		second := &Client{ID: "SECOND", send: make(chan []byte, 256)}
+		mustSubscribe(&broker.Hub, &Subscription{
+			Client:      second,
+			Topic:       "FAKETOPIC",
+			LastEventID: firstFrame.ID,
+		}, t)
+
+		got := []string{
+			string(decodeFrame(t, <-second.send).Payload),
+			string(decodeFrame(t, <-second.send).Payload),
+		}
+		want := []string{"two", "three"}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("replay[%d] = %q, want %q", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("Resubscribing with an aged-out LastEventID sends a resync notice instead of replaying", func(t *testing.T) {
+		broker := NewBroker([]string{"*"})
+
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 256)}
+		mustSubscribe(&broker.Hub, &Subscription{
+			Client:      client,
+			Topic:       "FAKETOPIC",
+			LastEventID: "no-such-event-id",
+		}, t)
+
+		frame := decodeFrame(t, <-client.send)
+		if frame.Type != frameTypeResyncRequired {
+			t.Fatalf("Type = %q, want %q", frame.Type, frameTypeResyncRequired)
+		}
+		if frame.Topic != "FAKETOPIC" {
+			t.Fatalf("Topic = %q, want %q", frame.Topic, "FAKETOPIC")
+		}
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("live")})
+		if got, want := getEmitMsg(client.send), "live"; got != want {
+			t.Fatalf("subscription did not go live after resync notice: got %s want %s", got, want)
+		}
+	})
+
+	t.Run("Replay that overflows the client's send buffer stops instead of silently skipping entries", func(t *testing.T) {
+		broker := NewBroker([]string{"*"})
+
+		first := &Client{ID: "FIRST", send: make(chan []byte, 256)}
+		mustSubscribe(&broker.Hub, &Subscription{Client: first, Topic: "FAKETOPIC"}, t)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("one")})
+		firstFrame := decodeFrame(t, <-first.send)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("two")})
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("three")})
+
+		// second's buffer only has room for one of the two missed entries,
+		// so replay must stop rather than skip "two" and deliver "three" on
+		// its own with no indication anything was missed.
+		second := &Client{ID: "SECOND", send: make(chan []byte, 1)}
+		mustSubscribe(&broker.Hub, &Subscription{
+			Client:      second,
+			Topic:       "FAKETOPIC",
+			LastEventID: firstFrame.ID,
+		}, t)
+
+		if got, want := getEmitMsg(second.send), "two"; got != want {
+			t.Fatalf("replay = %q, want %q", got, want)
+		}
+
+		select {
+		case frame := <-second.send:
+			t.Fatalf("replay should have stopped after the buffer filled, got extra frame %v", frame)
+		default:
+		}
+
+		broker.Hub.doEmit(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("live")})
+		if got, want := getEmitMsg(second.send), "live"; got != want {
+			t.Fatalf("subscription did not go live after overflowing replay: got %s want %s", got, want)
+		}
+	})
+}
+
+func TestHub_Transport(t *testing.T) {
+	t.Run("Local publish is forwarded to the transport", func(t *testing.T) {
+		transport := newFakeTransport()
+		broker := NewBroker([]string{"*"}, WithTransport(transport))
+		go broker.Run()
+
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 256)}
+		mustRegister(broker, client, t)
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "FAKETOPIC"}, t)
+
+		broker.Hub.Publish(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("payload")})
+
+		select {
+		case got := <-transport.published:
+			if got.Topic != "FAKETOPIC" {
+				t.Fatalf("Got topic %s want %s", got.Topic, "FAKETOPIC")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected publish to be forwarded to the transport")
+		}
+	})
+
+	t.Run("Inbound transport message reaches local subscribers without echoing back out", func(t *testing.T) {
+		transport := newFakeTransport()
+		broker := NewBroker([]string{"*"}, WithTransport(transport))
+		go broker.Run()
+
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 256)}
+		mustRegister(broker, client, t)
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "FAKETOPIC"}, t)
+
+		transport.deliver("FAKETOPIC", []byte("payload"))
+
+		frame := decodeFrame(t, <-client.send)
+		if string(frame.Payload) != "payload" {
+			t.Fatalf("Got payload %s want %s", frame.Payload, "payload")
+		}
+
+		select {
+		case <-transport.published:
+			t.Fatal("inbound transport message should not be re-published")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+// fakeTransport is an in-memory Transport test double that records what's
+// published and lets the test inject inbound messages via deliver.
+type fakeTransport struct {
+	published chan PublishMessage
+
+	mu       sync.Mutex
+	handlers map[string]func([]byte)
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		published: make(chan PublishMessage, 8),
+		handlers:  make(map[string]func([]byte)),
+	}
+}
+
+func (f *fakeTransport) Connect() error    { return nil }
+func (f *fakeTransport) Disconnect() error { return nil }
+
+func (f *fakeTransport) Publish(topic string, payload []byte) error {
+	f.published <- PublishMessage{Topic: topic, Payload: payload}
+	return nil
+}
+
+func (f *fakeTransport) Subscribe(topic string, handler func([]byte)) (Unsub, error) {
+	f.mu.Lock()
+	f.handlers[topic] = handler
+	f.mu.Unlock()
+	return func() {}, nil
+}
+
+func (f *fakeTransport) deliver(topic string, payload []byte) {
+	f.mu.Lock()
+	handler := f.handlers[topic]
+	f.mu.Unlock()
+
+	if handler != nil {
+		handler(payload)
+	}
+}
+
+func decodeFrame(t *testing.T, raw []byte) Frame {
+	var frame Frame
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		t.Fatalf("could not decode frame: %v", err)
+	}
+	return frame
+}
+
 func mustEmit(broker *Broker, client *Client, t *testing.T) {
 	want := "payload"
 
@@ -186,7 +416,12 @@ func mustEmit(broker *Broker, client *Client, t *testing.T) {
 
 func getEmitMsg(c <-chan []byte) string {
 	receive := <-c
-	return string(receive)
+
+	var frame Frame
+	if err := json.Unmarshal(receive, &frame); err != nil {
+		return string(receive)
+	}
+	return string(frame.Payload)
 }
 
 func TestHub_Publish(t *testing.T) {
@@ -257,6 +492,54 @@ func TestHub_DoSubscribeOverNetwork(t *testing.T) {
 	})
 }
 
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"rooms/1/chat", "rooms/1/chat", true},
+		{"rooms/+/chat", "rooms/1/chat", true},
+		{"rooms/+/chat", "rooms/1/2/chat", false},
+		{"rooms/#", "rooms/1/chat", true},
+		{"rooms/#", "rooms", true},
+		{"rooms/1/chat", "rooms/2/chat", false},
+	}
+
+	for _, c := range cases {
+		if got := MatchTopic(c.filter, c.topic); got != c.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", c.filter, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestHub_DoSubscribe_Wildcard(t *testing.T) {
+	t.Run("A wildcard subscriber receives a publish on a matching topic", func(t *testing.T) {
+		broker := NewBroker([]string{"*"})
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 256)}
+
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "rooms/+/chat"}, t)
+
+		broker.Hub.doEmit(PublishMessage{Topic: "rooms/1/chat", Payload: []byte("payload")})
+
+		if got, want := getEmitMsg(client.send), "payload"; got != want {
+			t.Fatalf("got %s want %s", got, want)
+		}
+	})
+
+	t.Run("Unregistering a wildcard subscriber cleans up the filter trie", func(t *testing.T) {
+		broker := NewBroker([]string{"*"})
+		client := &Client{ID: "FAKEUSER|ID", send: make(chan []byte, 256)}
+
+		mustRegister(broker, client, t)
+		mustSubscribe(&broker.Hub, &Subscription{Client: client, Topic: "rooms/#"}, t)
+		broker.Hub.doUnregister(client)
+
+		if matches := broker.Hub.wildcardTrie.Match("rooms/1/chat"); len(matches) != 0 {
+			t.Fatalf("expected no matches after unregister, got %v", matches)
+		}
+	})
+}
+
 func TestHub_GetClient(t *testing.T) {
 	t.Run("Get client in hub", func(t *testing.T) {
 		broker := NewBroker([]string{"*"})
@@ -347,6 +630,52 @@ func TestHub_Run(t *testing.T) {
 			t.Fatalf("Wanted calls %v got %v", want, spyNotifyPrinter.Calls)
 		}
 	})
+
+	t.Run("Janitor still fires under continuous publish traffic", func(t *testing.T) {
+		old := janitorInterval
+		janitorInterval = time.Millisecond
+		defer func() { janitorInterval = old }()
+
+		broker := NewBroker([]string{"*"}, WithDefaultTTL(5*time.Millisecond))
+		go broker.Run()
+
+		// FAKETOPIC is published once so its TTL clock starts, then left
+		// alone; CHURN is hammered continuously on a separate topic from
+		// several goroutines at once so Run never finds
+		// register/subscribe/emit/unregister all empty simultaneously. If
+		// the janitor tick can be starved by that traffic, FAKETOPIC's
+		// metadata will still be here once its TTL has long since elapsed.
+		broker.Hub.Publish(PublishMessage{Topic: "FAKETOPIC", Payload: []byte("x")})
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						broker.Hub.Publish(PublishMessage{Topic: "CHURN", Payload: []byte("x")})
+					}
+				}
+			}()
+		}
+
+		time.Sleep(300 * time.Millisecond)
+		close(stop)
+		wg.Wait()
+
+		broker.Hub.topicMu.Lock()
+		_, exists := broker.Hub.topicMeta["FAKETOPIC"]
+		broker.Hub.topicMu.Unlock()
+
+		if exists {
+			t.Fatal("janitor never reclaimed FAKETOPIC despite continuous publish traffic on another topic and an elapsed TTL")
+		}
+	})
 }
 
 func mustRegister(broker *Broker, client *Client, t *testing.T) {
@@ -360,7 +689,7 @@ func mustRegister(broker *Broker, client *Client, t *testing.T) {
 func mustSubscribe(hub *Hub, s *Subscription, t *testing.T) {
 	hub.doSubscribe(s)
 
-	clients, ok := hub.topics[s.Topic]
+	clients, ok := subscribedClients(hub, s.Topic)
 	if !ok {
 		t.Fatalf("Broker did not subscribe to topic %s", s.Topic)
 	}
@@ -382,27 +711,17 @@ func mustSubscribe(hub *Hub, s *Subscription, t *testing.T) {
 
 }
 
-type BrokerServer struct {
-	broker *Broker
-	http.Handler
-}
-
-func NewBrokerServer() *BrokerServer {
-	server := new(BrokerServer)
-	broker := NewBroker([]string{"*"})
-
-	go broker.Run()
-
-	server.broker = broker
-
-	router := mux.NewRouter()
-	router.Handle("/ws", negroni.New(
-		negroni.Wrap(broker),
-	))
-
-	server.Handler = router
+// subscribedClients looks topic up in whichever of hub.topics or
+// hub.wildcardClients doSubscribe routed it to, so test helpers don't need
+// to know a topic's wildcard-ness ahead of time.
+func subscribedClients(hub *Hub, topic string) ([]*Client, bool) {
+	if hasWildcard(topic) {
+		clients, ok := hub.wildcardClients[topic]
+		return clients, ok
+	}
 
-	return server
+	clients, ok := hub.topics[topic]
+	return clients, ok
 }
 
 func mustDialWs(t *testing.T, url string) *websocket.Conn {
@@ -413,3 +732,84 @@ func mustDialWs(t *testing.T, url string) *websocket.Conn {
 
 	return ws
 }
+
+func TestBrokerServer_TopicHTTP(t *testing.T) {
+	t.Run("POST publishes and GET /topics lists the topic", func(t *testing.T) {
+		server := httptest.NewServer(NewBrokerServer())
+		defer server.Close()
+
+		resp, err := http.Post(server.URL+"/topic/NEWS", "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("POST /topic/NEWS: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var published struct {
+			ID  string `json:"id"`
+			Seq uint64 `json:"seq"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&published); err != nil {
+			t.Fatalf("decode publish response: %v", err)
+		}
+		if published.Seq != 1 {
+			t.Fatalf("Got seq %d want %d", published.Seq, 1)
+		}
+
+		topicsResp, err := http.Get(server.URL + "/topics")
+		if err != nil {
+			t.Fatalf("GET /topics: %v", err)
+		}
+		defer topicsResp.Body.Close()
+
+		var topics []TopicInfo
+		if err := json.NewDecoder(topicsResp.Body).Decode(&topics); err != nil {
+			t.Fatalf("decode topics response: %v", err)
+		}
+
+		found := false
+		for _, topic := range topics {
+			if topic.Name == "NEWS" && topic.Seq == 1 {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("Expected NEWS in %v", topics)
+		}
+	})
+
+	t.Run("GET /topic long-polls for the next message", func(t *testing.T) {
+		server := httptest.NewServer(NewBrokerServer())
+		defer server.Close()
+
+		result := make(chan *http.Response, 1)
+		go func() {
+			resp, err := http.Get(server.URL + "/topic/LIVE")
+			if err != nil {
+				t.Errorf("GET /topic/LIVE: %v", err)
+				return
+			}
+			result <- resp
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+
+		if _, err := http.Post(server.URL+"/topic/LIVE", "text/plain", strings.NewReader("ping")); err != nil {
+			t.Fatalf("POST /topic/LIVE: %v", err)
+		}
+
+		select {
+		case resp := <-result:
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("read long-poll body: %v", err)
+			}
+			frame := decodeFrame(t, body)
+			if string(frame.Payload) != "ping" {
+				t.Fatalf("Got payload %s want %s", frame.Payload, "ping")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for long-poll consumer")
+		}
+	})
+}
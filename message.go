@@ -0,0 +1,71 @@
+package hub
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PublishMessage is a payload destined for every client subscribed to Topic.
+type PublishMessage struct {
+	Topic   string
+	Payload []byte
+
+	// fromTransport marks a message that re-entered emit from
+	// Transport.Subscribe, so Run doesn't forward it back out and create
+	// an echo loop between processes.
+	fromTransport bool
+
+	// ttlOverride, if set, replaces the topic's configured TTL as of this
+	// publish. Used by BrokerServer's POST /topic/{name} to honor a
+	// per-publish TTL header.
+	ttlOverride time.Duration
+
+	// result, if non-nil, receives the HistoryEntry this publish was
+	// assigned once Run has processed it. Callers must send on a buffered
+	// channel of size 1 so doEmit never blocks delivering it.
+	result chan HistoryEntry
+}
+
+// frameTypeResyncRequired marks a Frame that carries no message, only
+// notice that the hub could not satisfy a Subscription.LastEventID replay,
+// either because the ID had already aged out of history or because the
+// replay overflowed the client's send buffer. A normal message Frame omits
+// Type.
+const frameTypeResyncRequired = "resync_required"
+
+// Frame is the envelope actually written to a client's WebSocket
+// connection. It carries the HistoryEntry's event ID and per-topic
+// sequence number alongside the payload so clients can persist the ID and
+// resume from it via Subscription.LastEventID after a reconnect. Type is
+// empty for an ordinary message Frame; see frameTypeResyncRequired for the
+// one case it's set.
+type Frame struct {
+	Type    string `json:"type,omitempty"`
+	ID      string `json:"id"`
+	Seq     uint64 `json:"seq"`
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+// newFrame serializes a HistoryEntry for delivery to a client. If
+// marshaling fails, it falls back to the raw payload so a history store
+// bug can't silently blackhole messages.
+func newFrame(e HistoryEntry) []byte {
+	data, err := json.Marshal(Frame{ID: e.ID, Seq: e.Seq, Topic: e.Topic, Payload: e.Payload})
+	if err != nil {
+		return e.Payload
+	}
+	return data
+}
+
+// newResyncRequiredFrame serializes a notice that the replay of topic's
+// history since the LastEventID a Subscription asked to resume from is
+// incomplete, so the client knows to fall back to a full resync instead of
+// assuming it received a gap-free replay.
+func newResyncRequiredFrame(topic string) []byte {
+	data, err := json.Marshal(Frame{Type: frameTypeResyncRequired, Topic: topic})
+	if err != nil {
+		return nil
+	}
+	return data
+}
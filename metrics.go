@@ -0,0 +1,113 @@
+package hub
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// PrometheusCollector is a built-in EventHook that exposes hub activity as
+// Prometheus metrics: clients connected, topics active, messages published
+// per topic, bytes sent, slow-consumer drops, and a publish fan-out
+// latency histogram. Install it with WithEventHook and mount Handler on
+// whatever path scrapers expect (BrokerServer serves it at /metrics).
+type PrometheusCollector struct {
+	registry *prometheus.Registry
+
+	clientsConnected  prometheus.Gauge
+	topicsActive      prometheus.Gauge
+	messagesPublished *prometheus.CounterVec
+	bytesSent         prometheus.Counter
+	slowConsumerDrops prometheus.Counter
+	publishLatency    prometheus.Histogram
+
+	topicsMu sync.Mutex
+	topics   map[string]bool
+}
+
+// NewPrometheusCollector creates a PrometheusCollector with its own
+// registry, so multiple Brokers in the same process don't collide on
+// metric names.
+func NewPrometheusCollector() *PrometheusCollector {
+	c := &PrometheusCollector{
+		registry: prometheus.NewRegistry(),
+		clientsConnected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "hub_clients_connected",
+			Help: "Number of clients currently registered with the hub.",
+		}),
+		topicsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "hub_topics_active",
+			Help: "Number of distinct topics that have had at least one publish. Monotonic: it does not fall when a topic empties out or is TTL-reclaimed.",
+		}),
+		messagesPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hub_messages_published_total",
+			Help: "Messages published, by topic.",
+		}, []string{"topic"}),
+		bytesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hub_bytes_sent_total",
+			Help: "Payload bytes delivered to subscribers.",
+		}),
+		slowConsumerDrops: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hub_slow_consumer_drops_total",
+			Help: "Clients disconnected because their send buffer was full.",
+		}),
+		publishLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "hub_publish_fanout_seconds",
+			Help:    "Time to fan a published message out to its subscribers.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		topics: make(map[string]bool),
+	}
+
+	c.registry.MustRegister(
+		c.clientsConnected,
+		c.topicsActive,
+		c.messagesPublished,
+		c.bytesSent,
+		c.slowConsumerDrops,
+		c.publishLatency,
+	)
+
+	return c
+}
+
+// Handler serves the collector's metrics in the Prometheus text exposition
+// format.
+func (c *PrometheusCollector) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{})
+}
+
+// OnRegister implements EventHook.
+func (c *PrometheusCollector) OnRegister(client *Client) {
+	c.clientsConnected.Inc()
+}
+
+// OnSubscribe implements EventHook. topicsActive is tracked from OnPublish
+// instead, so a topic published via POST /topic with no subscriber still
+// counts.
+func (c *PrometheusCollector) OnSubscribe(s *Subscription) {}
+
+// OnPublish implements EventHook.
+func (c *PrometheusCollector) OnPublish(msg PublishMessage, delivered, dropped int, elapsed time.Duration) {
+	c.topicsMu.Lock()
+	if !c.topics[msg.Topic] {
+		c.topics[msg.Topic] = true
+		c.topicsActive.Set(float64(len(c.topics)))
+	}
+	c.topicsMu.Unlock()
+
+	c.messagesPublished.WithLabelValues(msg.Topic).Inc()
+	c.bytesSent.Add(float64(delivered * len(msg.Payload)))
+	c.publishLatency.Observe(elapsed.Seconds())
+}
+
+// OnUnregister implements EventHook.
+func (c *PrometheusCollector) OnUnregister(client *Client, reason DisconnectReason) {
+	c.clientsConnected.Dec()
+	if reason == ReasonSlowConsumer {
+		c.slowConsumerDrops.Inc()
+	}
+}
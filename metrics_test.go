@@ -0,0 +1,133 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gaugeValue(t *testing.T, g interface{ Write(*dto.Metric) error }) float64 {
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if m.Gauge != nil {
+		return m.Gauge.GetValue()
+	}
+	if m.Counter != nil {
+		return m.Counter.GetValue()
+	}
+	return 0
+}
+
+func TestPrometheusCollector_OnRegister(t *testing.T) {
+	t.Run("clientsConnected tracks register/unregister", func(t *testing.T) {
+		c := NewPrometheusCollector()
+		first := &Client{ID: "FIRST"}
+		second := &Client{ID: "SECOND"}
+
+		c.OnRegister(first)
+		c.OnRegister(second)
+		if got, want := gaugeValue(t, c.clientsConnected), 2.0; got != want {
+			t.Fatalf("clientsConnected = %v, want %v", got, want)
+		}
+
+		c.OnUnregister(first, ReasonClientClosed)
+		if got, want := gaugeValue(t, c.clientsConnected), 1.0; got != want {
+			t.Fatalf("clientsConnected = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestPrometheusCollector_OnPublish(t *testing.T) {
+	t.Run("topicsActive counts distinct published topics, including ones with no subscriber", func(t *testing.T) {
+		c := NewPrometheusCollector()
+
+		c.OnPublish(PublishMessage{Topic: "rooms/1"}, 0, 0, 0)
+		c.OnPublish(PublishMessage{Topic: "rooms/2"}, 0, 0, 0)
+		c.OnPublish(PublishMessage{Topic: "rooms/1"}, 0, 0, 0)
+
+		if got, want := gaugeValue(t, c.topicsActive), 2.0; got != want {
+			t.Fatalf("topicsActive = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("records bytes sent, per-topic count, and fan-out latency", func(t *testing.T) {
+		c := NewPrometheusCollector()
+
+		msg := PublishMessage{Topic: "rooms/1", Payload: []byte("hello")}
+		c.OnPublish(msg, 2, 1, 5*time.Millisecond)
+
+		if got, want := gaugeValue(t, c.bytesSent), 10.0; got != want {
+			t.Fatalf("bytesSent = %v, want %v", got, want)
+		}
+
+		var m dto.Metric
+		if err := c.messagesPublished.WithLabelValues("rooms/1").Write(&m); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if got, want := m.Counter.GetValue(), 1.0; got != want {
+			t.Fatalf("messagesPublished[rooms/1] = %v, want %v", got, want)
+		}
+
+		var h dto.Metric
+		if err := c.publishLatency.Write(&h); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if got, want := h.Histogram.GetSampleCount(), uint64(1); got != want {
+			t.Fatalf("publishLatency sample count = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestPrometheusCollector_OnUnregister(t *testing.T) {
+	t.Run("slowConsumerDrops only counts slow-consumer disconnects", func(t *testing.T) {
+		c := NewPrometheusCollector()
+		client := &Client{ID: "FAKEUSER|ID"}
+
+		c.OnRegister(client)
+		c.OnUnregister(client, ReasonClientClosed)
+		if got, want := gaugeValue(t, c.slowConsumerDrops), 0.0; got != want {
+			t.Fatalf("slowConsumerDrops = %v, want %v", got, want)
+		}
+
+		c.OnUnregister(client, ReasonSlowConsumer)
+		if got, want := gaugeValue(t, c.slowConsumerDrops), 1.0; got != want {
+			t.Fatalf("slowConsumerDrops = %v, want %v", got, want)
+		}
+	})
+}
+
+// spyNotifier records the last event name it was notified of, for
+// notifierHook's adapter tests below.
+type spyNotifier struct {
+	last string
+}
+
+func (s *spyNotifier) Notify(event string) { s.last = event }
+
+func TestNotifierHook(t *testing.T) {
+	spy := &spyNotifier{}
+	hook := &notifierHook{n: spy}
+
+	hook.OnRegister(&Client{})
+	if spy.last != "register" {
+		t.Fatalf("OnRegister notified %q, want %q", spy.last, "register")
+	}
+
+	hook.OnSubscribe(&Subscription{})
+	if spy.last != "subscribe" {
+		t.Fatalf("OnSubscribe notified %q, want %q", spy.last, "subscribe")
+	}
+
+	hook.OnPublish(PublishMessage{}, 0, 0, 0)
+	if spy.last != "publish" {
+		t.Fatalf("OnPublish notified %q, want %q", spy.last, "publish")
+	}
+
+	hook.OnUnregister(&Client{}, ReasonClientClosed)
+	if spy.last != "unregister" {
+		t.Fatalf("OnUnregister notified %q, want %q", spy.last, "unregister")
+	}
+}
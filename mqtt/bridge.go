@@ -0,0 +1,49 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"net"
+
+	hub "github.com/TranquilityApp/websocket-hub"
+)
+
+func init() {
+	hub.RegisterMQTTListenerFunc(listen)
+}
+
+// listen starts accepting MQTT connections on addr, bridging each into
+// broker's topic space. It implements hub.MQTTListenerFunc and is wired up
+// to hub.WithMQTTListener by this package's init().
+func listen(addr string, broker *hub.Broker) (stop func() error, err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	serve(ln, broker)
+	return ln.Close, nil
+}
+
+// ListenTLS is like the listener started by hub.WithMQTTListener, but
+// accepts MQTTS (MQTT over TLS) connections. Callers that need TLS should
+// use this directly instead of WithMQTTListener, which always dials plain
+// TCP.
+func ListenTLS(addr string, broker *hub.Broker, config *tls.Config) (stop func() error, err error) {
+	ln, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	serve(ln, broker)
+	return ln.Close, nil
+}
+
+func serve(ln net.Listener, broker *hub.Broker) {
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go newSession(conn, broker).serve()
+		}
+	}()
+}
@@ -0,0 +1,333 @@
+// Package mqtt bridges MQTT 3.1.1/5.0 clients into a hub.Broker's topic
+// space: MQTT CONNECT/SUBSCRIBE/PUBLISH packets over TCP or TLS are
+// translated to hub subscriptions and PublishMessages, and hub frames are
+// translated back into MQTT PUBLISH packets for matching sessions.
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// packetType is an MQTT control packet type, the top 4 bits of the fixed
+// header's first byte.
+type packetType byte
+
+const (
+	typeCONNECT     packetType = 1
+	typeCONNACK     packetType = 2
+	typePUBLISH     packetType = 3
+	typePUBACK      packetType = 4
+	typeSUBSCRIBE   packetType = 8
+	typeSUBACK      packetType = 9
+	typeUNSUBSCRIBE packetType = 10
+	typeUNSUBACK    packetType = 11
+	typePINGREQ     packetType = 12
+	typePINGRESP    packetType = 13
+	typeDISCONNECT  packetType = 14
+)
+
+var errMalformedPacket = errors.New("mqtt: malformed packet")
+
+// packet is a decoded MQTT control packet: its fixed header plus the raw
+// variable header and payload bytes, still to be parsed by type-specific
+// decode functions below.
+type packet struct {
+	typ   packetType
+	flags byte
+	body  []byte
+}
+
+// readPacket reads one MQTT control packet from r.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return &packet{
+		typ:   packetType(first >> 4),
+		flags: first & 0x0f,
+		body:  body,
+	}, nil
+}
+
+// readVarInt reads an MQTT variable byte integer (used for the fixed
+// header's remaining length, and for MQTT 5 property lengths).
+func readVarInt(r *bufio.Reader) (int, error) {
+	var value, multiplier int
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value += int(b&0x7f) * multiplier1(multiplier)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+		multiplier += 7
+	}
+	return 0, errMalformedPacket
+}
+
+func multiplier1(shift int) int {
+	if shift == 0 {
+		return 1
+	}
+	m := 1
+	for i := 0; i < shift; i += 7 {
+		m *= 128
+	}
+	return m
+}
+
+// appendVarInt appends an MQTT variable byte integer encoding of n to buf.
+func appendVarInt(buf []byte, n int) []byte {
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			return buf
+		}
+	}
+}
+
+// readString reads a two-byte-length-prefixed UTF-8 string, as used
+// throughout the MQTT variable header and payload.
+func readString(buf []byte) (string, []byte, error) {
+	if len(buf) < 2 {
+		return "", nil, errMalformedPacket
+	}
+	n := int(buf[0])<<8 | int(buf[1])
+	buf = buf[2:]
+	if len(buf) < n {
+		return "", nil, errMalformedPacket
+	}
+	return string(buf[:n]), buf[n:], nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, byte(len(s)>>8), byte(len(s)))
+	return append(buf, s...)
+}
+
+// skipProperties consumes an MQTT 5 properties block (a varint length
+// followed by that many bytes of TLV-encoded properties). MQTT 3.1.1
+// packets have no properties block and this is never called for them.
+func skipProperties(buf []byte) ([]byte, error) {
+	r := &sliceByteReader{buf: buf}
+	n, err := readVarIntFromSlice(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos+n > len(buf) {
+		return nil, errMalformedPacket
+	}
+	return buf[r.pos+n:], nil
+}
+
+type sliceByteReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *sliceByteReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, io.EOF
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func readVarIntFromSlice(r *sliceByteReader) (int, error) {
+	var value, shift int
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value += int(b&0x7f) * multiplier1(shift)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+		shift += 7
+	}
+	return 0, errMalformedPacket
+}
+
+// connectPacket is the decoded variable header and payload of a CONNECT
+// packet, covering both the 3.1.1 and (so far as session.go cares) 5.0
+// wire formats.
+type connectPacket struct {
+	protocolLevel byte
+	cleanSession  bool
+	clientID      string
+	keepAlive     uint16
+}
+
+func decodeConnect(body []byte) (*connectPacket, error) {
+	protoName, rest, err := readString(body)
+	if err != nil {
+		return nil, err
+	}
+	if protoName != "MQTT" && protoName != "MQIsdp" {
+		return nil, errMalformedPacket
+	}
+	if len(rest) < 4 {
+		return nil, errMalformedPacket
+	}
+
+	level := rest[0]
+	connectFlags := rest[1]
+	keepAlive := uint16(rest[2])<<8 | uint16(rest[3])
+	rest = rest[4:]
+
+	if level >= 5 {
+		rest, err = skipProperties(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clientID, rest, err := readString(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Username/password/will fields are accepted but not used: the hub
+	// bridge has no auth hook yet, so every CONNECT is admitted.
+	_ = rest
+
+	return &connectPacket{
+		protocolLevel: level,
+		cleanSession:  connectFlags&0x02 != 0,
+		clientID:      clientID,
+		keepAlive:     keepAlive,
+	}, nil
+}
+
+// connackSuccess encodes a CONNACK packet accepting the connection.
+func connackSuccess() []byte {
+	return []byte{byte(typeCONNACK) << 4, 2, 0, 0}
+}
+
+// subscribePacket is a decoded SUBSCRIBE packet.
+type subscribePacket struct {
+	packetID uint16
+	filters  []string
+}
+
+func decodeSubscribe(body []byte, protocolLevel byte) (*subscribePacket, error) {
+	if len(body) < 2 {
+		return nil, errMalformedPacket
+	}
+	packetID := uint16(body[0])<<8 | uint16(body[1])
+	rest := body[2:]
+
+	if protocolLevel >= 5 {
+		var err error
+		rest, err = skipProperties(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filters []string
+	for len(rest) > 0 {
+		filter, next, err := readString(rest)
+		if err != nil {
+			return nil, err
+		}
+		if len(next) < 1 {
+			return nil, errMalformedPacket
+		}
+		rest = next[1:] // skip the requested-QoS byte
+		filters = append(filters, filter)
+	}
+
+	return &subscribePacket{packetID: packetID, filters: filters}, nil
+}
+
+// encodeSuback builds a SUBACK granting QoS 0 for each of n subscriptions.
+func encodeSuback(packetID uint16, n int) []byte {
+	var buf []byte
+	buf = append(buf, byte(packetID>>8), byte(packetID))
+	for i := 0; i < n; i++ {
+		buf = append(buf, 0)
+	}
+
+	out := []byte{byte(typeSUBACK) << 4}
+	out = appendVarInt(out, len(buf))
+	return append(out, buf...)
+}
+
+// publishPacket is a decoded PUBLISH packet. The bridge only speaks QoS 0,
+// matching the hub's current at-most-once delivery; qos/packetID are kept
+// so a QoS-1/2 publisher still gets a well-formed (if redundant) PUBACK.
+type publishPacket struct {
+	topic    string
+	qos      byte
+	packetID uint16
+	payload  []byte
+}
+
+func decodePublish(body []byte, flags byte, protocolLevel byte) (*publishPacket, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return nil, err
+	}
+
+	qos := (flags >> 1) & 0x03
+	var packetID uint16
+	if qos > 0 {
+		if len(rest) < 2 {
+			return nil, errMalformedPacket
+		}
+		packetID = uint16(rest[0])<<8 | uint16(rest[1])
+		rest = rest[2:]
+	}
+
+	if protocolLevel >= 5 {
+		rest, err = skipProperties(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &publishPacket{topic: topic, qos: qos, packetID: packetID, payload: rest}, nil
+}
+
+// encodePublish builds a QoS 0 PUBLISH packet carrying payload on topic.
+func encodePublish(topic string, payload []byte) []byte {
+	var buf []byte
+	buf = appendString(buf, topic)
+	buf = append(buf, payload...)
+
+	out := []byte{byte(typePUBLISH) << 4}
+	out = appendVarInt(out, len(buf))
+	return append(out, buf...)
+}
+
+func encodePuback(packetID uint16) []byte {
+	return []byte{byte(typePUBACK) << 4, 2, byte(packetID >> 8), byte(packetID)}
+}
+
+func encodePingresp() []byte {
+	return []byte{byte(typePINGRESP) << 4, 0}
+}
@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestReadPacket(t *testing.T) {
+	t.Run("fixed header plus body", func(t *testing.T) {
+		body := []byte("hello")
+		raw := append([]byte{byte(typePUBLISH) << 4, byte(len(body))}, body...)
+
+		p, err := readPacket(bufio.NewReader(bytes.NewReader(raw)))
+		if err != nil {
+			t.Fatalf("readPacket: %v", err)
+		}
+		if p.typ != typePUBLISH {
+			t.Fatalf("typ = %v, want %v", p.typ, typePUBLISH)
+		}
+		if string(p.body) != "hello" {
+			t.Fatalf("body = %q, want %q", p.body, "hello")
+		}
+	})
+
+	t.Run("zero-length body, e.g. PINGREQ", func(t *testing.T) {
+		raw := []byte{byte(typePINGREQ) << 4, 0}
+
+		p, err := readPacket(bufio.NewReader(bytes.NewReader(raw)))
+		if err != nil {
+			t.Fatalf("readPacket: %v", err)
+		}
+		if p.typ != typePINGREQ || len(p.body) != 0 {
+			t.Fatalf("got %+v, want empty PINGREQ", p)
+		}
+	})
+}
+
+func TestVarInt(t *testing.T) {
+	cases := []int{0, 1, 127, 128, 16383, 16384, 2097151}
+
+	for _, n := range cases {
+		buf := appendVarInt(nil, n)
+		got, err := readVarInt(bufio.NewReader(bytes.NewReader(buf)))
+		if err != nil {
+			t.Fatalf("readVarInt(%d): %v", n, err)
+		}
+		if got != n {
+			t.Fatalf("readVarInt(appendVarInt(%d)) = %d", n, got)
+		}
+	}
+}
+
+func TestDecodeConnect(t *testing.T) {
+	t.Run("3.1.1", func(t *testing.T) {
+		body := appendString(nil, "MQTT")
+		body = append(body, 4, 0x02, 0, 60) // level 4, clean session, keepAlive 60
+		body = appendString(body, "client-1")
+
+		got, err := decodeConnect(body)
+		if err != nil {
+			t.Fatalf("decodeConnect: %v", err)
+		}
+		want := connectPacket{protocolLevel: 4, cleanSession: true, clientID: "client-1", keepAlive: 60}
+		if *got != want {
+			t.Fatalf("got %+v, want %+v", *got, want)
+		}
+	})
+
+	t.Run("5.0 skips the properties block", func(t *testing.T) {
+		body := appendString(nil, "MQTT")
+		body = append(body, 5, 0x02, 0, 30)
+		body = append(body, 0) // empty properties block
+		body = appendString(body, "client-2")
+
+		got, err := decodeConnect(body)
+		if err != nil {
+			t.Fatalf("decodeConnect: %v", err)
+		}
+		want := connectPacket{protocolLevel: 5, cleanSession: true, clientID: "client-2", keepAlive: 30}
+		if *got != want {
+			t.Fatalf("got %+v, want %+v", *got, want)
+		}
+	})
+
+	t.Run("rejects an unknown protocol name", func(t *testing.T) {
+		body := appendString(nil, "BOGUS")
+		body = append(body, 4, 0, 0, 0)
+
+		if _, err := decodeConnect(body); err != errMalformedPacket {
+			t.Fatalf("err = %v, want errMalformedPacket", err)
+		}
+	})
+}
+
+func TestDecodeSubscribe(t *testing.T) {
+	body := []byte{0, 7} // packetID 7
+	body = appendString(body, "rooms/+/chat")
+	body = append(body, 0) // requested QoS
+	body = appendString(body, "alerts/#")
+	body = append(body, 1)
+
+	got, err := decodeSubscribe(body, 4)
+	if err != nil {
+		t.Fatalf("decodeSubscribe: %v", err)
+	}
+	if got.packetID != 7 {
+		t.Fatalf("packetID = %d, want 7", got.packetID)
+	}
+
+	wantFilters := []string{"rooms/+/chat", "alerts/#"}
+	if len(got.filters) != len(wantFilters) {
+		t.Fatalf("filters = %v, want %v", got.filters, wantFilters)
+	}
+	for i, f := range wantFilters {
+		if got.filters[i] != f {
+			t.Fatalf("filters[%d] = %q, want %q", i, got.filters[i], f)
+		}
+	}
+}
+
+func TestDecodePublish(t *testing.T) {
+	t.Run("QoS 0 has no packet ID", func(t *testing.T) {
+		body := appendString(nil, "rooms/1/chat")
+		body = append(body, "payload"...)
+
+		got, err := decodePublish(body, 0, 4)
+		if err != nil {
+			t.Fatalf("decodePublish: %v", err)
+		}
+		if got.topic != "rooms/1/chat" || got.qos != 0 || string(got.payload) != "payload" {
+			t.Fatalf("got %+v", got)
+		}
+	})
+
+	t.Run("QoS 1 carries a packet ID", func(t *testing.T) {
+		body := appendString(nil, "rooms/1/chat")
+		body = append(body, 0, 42)
+		body = append(body, "payload"...)
+
+		got, err := decodePublish(body, 2 /* QoS 1 in bits 1-2 */, 4)
+		if err != nil {
+			t.Fatalf("decodePublish: %v", err)
+		}
+		if got.qos != 1 || got.packetID != 42 || string(got.payload) != "payload" {
+			t.Fatalf("got %+v", got)
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net"
+	"sync"
+
+	hub "github.com/TranquilityApp/websocket-hub"
+)
+
+// session bridges one MQTT connection into broker's topic space: its
+// SUBSCRIBEs become hub.Listeners, its PUBLISHes become hub.PublishMessages,
+// and hub frames on any subscribed topic are written back as MQTT PUBLISH
+// packets.
+type session struct {
+	conn   net.Conn
+	broker *hub.Broker
+	w      *bufio.Writer
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	listeners map[string]*hub.Listener
+
+	protocolLevel byte
+}
+
+func newSession(conn net.Conn, broker *hub.Broker) *session {
+	return &session{
+		conn:      conn,
+		broker:    broker,
+		w:         bufio.NewWriter(conn),
+		listeners: make(map[string]*hub.Listener),
+	}
+}
+
+// serve handles conn until it disconnects or a protocol error occurs.
+func (s *session) serve() {
+	defer s.close()
+
+	r := bufio.NewReader(s.conn)
+
+	first, err := readPacket(r)
+	if err != nil || first.typ != typeCONNECT {
+		return
+	}
+
+	connect, err := decodeConnect(first.body)
+	if err != nil {
+		return
+	}
+	s.protocolLevel = connect.protocolLevel
+
+	if err := s.write(connackSuccess()); err != nil {
+		return
+	}
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch p.typ {
+		case typeSUBSCRIBE:
+			s.handleSubscribe(p.body)
+		case typeUNSUBSCRIBE:
+			s.handleUnsubscribe(p.body)
+		case typePUBLISH:
+			s.handlePublish(p.body, p.flags)
+		case typePINGREQ:
+			s.write(encodePingresp())
+		case typeDISCONNECT:
+			return
+		}
+	}
+}
+
+func (s *session) handleSubscribe(body []byte) {
+	sub, err := decodeSubscribe(body, s.protocolLevel)
+	if err != nil {
+		return
+	}
+
+	for _, filter := range sub.filters {
+		s.subscribe(filter)
+	}
+
+	s.write(encodeSuback(sub.packetID, len(sub.filters)))
+}
+
+func (s *session) subscribe(filter string) {
+	s.mu.Lock()
+	if _, ok := s.listeners[filter]; ok {
+		s.mu.Unlock()
+		return
+	}
+	listener := s.broker.Listen(filter)
+	s.listeners[filter] = listener
+	s.mu.Unlock()
+
+	go s.forward(listener)
+}
+
+// forward relays hub frames delivered to listener as MQTT PUBLISH packets
+// until the listener is closed (via handleUnsubscribe or session close).
+func (s *session) forward(listener *hub.Listener) {
+	for raw := range listener.Frames() {
+		var frame hub.Frame
+		if err := json.Unmarshal(raw, &frame); err != nil {
+			log.Printf("mqtt: dropping malformed hub frame: %v", err)
+			continue
+		}
+		if err := s.write(encodePublish(frame.Topic, frame.Payload)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) handleUnsubscribe(body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	packetID := uint16(body[0])<<8 | uint16(body[1])
+	rest := body[2:]
+
+	if s.protocolLevel >= 5 {
+		var err error
+		rest, err = skipProperties(rest)
+		if err != nil {
+			return
+		}
+	}
+
+	for len(rest) > 0 {
+		filter, next, err := readString(rest)
+		if err != nil {
+			return
+		}
+		rest = next
+
+		s.mu.Lock()
+		if listener, ok := s.listeners[filter]; ok {
+			delete(s.listeners, filter)
+			listener.Close()
+		}
+		s.mu.Unlock()
+	}
+
+	out := []byte{byte(typeUNSUBACK) << 4}
+	out = appendVarInt(out, 2)
+	out = append(out, byte(packetID>>8), byte(packetID))
+	s.write(out)
+}
+
+func (s *session) handlePublish(body []byte, flags byte) {
+	pub, err := decodePublish(body, flags, s.protocolLevel)
+	if err != nil {
+		return
+	}
+
+	s.broker.Publish(hub.PublishMessage{Topic: pub.topic, Payload: pub.payload})
+
+	if pub.qos > 0 {
+		s.write(encodePuback(pub.packetID))
+	}
+}
+
+func (s *session) write(b []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *session) close() {
+	s.mu.Lock()
+	for filter, listener := range s.listeners {
+		listener.Close()
+		delete(s.listeners, filter)
+	}
+	s.mu.Unlock()
+
+	s.conn.Close()
+}
@@ -0,0 +1,19 @@
+package hub
+
+// MQTTListenerFunc starts a listener that bridges MQTT clients into
+// broker's topic space, and returns a function that stops it. It's
+// implemented by the mqtt subpackage's init(), which calls
+// RegisterMQTTListenerFunc; it is nil until that package is imported.
+type MQTTListenerFunc func(addr string, broker *Broker) (stop func() error, err error)
+
+var mqttListenerFunc MQTTListenerFunc
+
+// RegisterMQTTListenerFunc wires WithMQTTListener up to a real
+// implementation. It's called from the mqtt subpackage's init(), not by
+// application code; blank-import github.com/TranquilityApp/websocket-hub/mqtt
+// to make WithMQTTListener functional:
+//
+//	import _ "github.com/TranquilityApp/websocket-hub/mqtt"
+func RegisterMQTTListenerFunc(fn MQTTListenerFunc) {
+	mqttListenerFunc = fn
+}
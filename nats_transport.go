@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSTransport fans publishes out through a NATS server, using the hub
+// topic name as the NATS subject, so every websocket-hub process
+// subscribed to the same server shares a logical topic space.
+type NATSTransport struct {
+	url  string
+	opts []nats.Option
+	conn *nats.Conn
+}
+
+// NewNATSTransport creates a NATSTransport that dials url (see
+// nats.Connect) when Connect is called.
+func NewNATSTransport(url string, opts ...nats.Option) *NATSTransport {
+	return &NATSTransport{url: url, opts: opts}
+}
+
+// Connect implements Transport.
+func (t *NATSTransport) Connect() error {
+	conn, err := nats.Connect(t.url, t.opts...)
+	if err != nil {
+		return fmt.Errorf("hub: connect to nats: %w", err)
+	}
+	t.conn = conn
+	return nil
+}
+
+// Disconnect implements Transport.
+func (t *NATSTransport) Disconnect() error {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	return nil
+}
+
+// Publish implements Transport.
+func (t *NATSTransport) Publish(topic string, payload []byte) error {
+	return t.conn.Publish(topic, payload)
+}
+
+// Subscribe implements Transport.
+func (t *NATSTransport) Subscribe(topic string, handler func(payload []byte)) (Unsub, error) {
+	sub, err := t.conn.Subscribe(topic, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { _ = sub.Unsubscribe() }, nil
+}
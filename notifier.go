@@ -0,0 +1,9 @@
+package hub
+
+// Notifier is notified of hub lifecycle events by name. It's deliberately
+// minimal so callers can wire up logging, metrics, or test spies without the
+// hub taking a dependency on any particular backend. EventHook supersedes
+// it with typed callbacks; WithNotifier adapts a Notifier into one.
+type Notifier interface {
+	Notify(event string)
+}
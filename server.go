@@ -0,0 +1,184 @@
+package hub
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+)
+
+// longPollTimeout bounds how long GET /topic/{name} waits for a message
+// before returning 204 No Content.
+const longPollTimeout = 30 * time.Second
+
+// BrokerServer wires a Broker's WebSocket endpoint into an HTTP router, and
+// is the entry point embedding applications serve.
+type BrokerServer struct {
+	broker *Broker
+	http.Handler
+
+	brokerOpts []BrokerOption
+
+	mqttAddr string
+	mqttStop func() error
+
+	metrics *PrometheusCollector
+}
+
+// BrokerServerOption configures a BrokerServer at construction time.
+type BrokerServerOption func(*BrokerServer)
+
+// WithMQTTListener starts an MQTT 3.1.1/5.0 listener on addr, bridging MQTT
+// sessions into the broker's topic space. Requires blank-importing
+// github.com/TranquilityApp/websocket-hub/mqtt, which registers the
+// implementation; without it, NewBrokerServer logs an error and starts
+// without the listener.
+func WithMQTTListener(addr string) BrokerServerOption {
+	return func(s *BrokerServer) {
+		s.mqttAddr = addr
+	}
+}
+
+// WithMetrics installs collector as the broker's EventHook and mounts its
+// Prometheus handler at /metrics.
+func WithMetrics(collector *PrometheusCollector) BrokerServerOption {
+	return func(s *BrokerServer) {
+		s.metrics = collector
+	}
+}
+
+// WithBrokerOptions forwards opts to NewBroker when NewBrokerServer builds
+// its Broker, e.g. WithTransport for a multi-process NATS/HTTP deployment,
+// WithHistoryStore for a BoltDB-backed history, or WithDeliveryPolicy to
+// tune AtLeastOnce redelivery — otherwise unreachable from the packaged
+// HTTP server.
+func WithBrokerOptions(opts ...BrokerOption) BrokerServerOption {
+	return func(s *BrokerServer) {
+		s.brokerOpts = append(s.brokerOpts, opts...)
+	}
+}
+
+// NewBrokerServer creates a BrokerServer with its broker's run loop started
+// and the WebSocket and msgbus-style HTTP routes mounted.
+func NewBrokerServer(opts ...BrokerServerOption) *BrokerServer {
+	server := new(BrokerServer)
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	broker := NewBroker([]string{"*"}, server.brokerOpts...)
+	server.broker = broker
+
+	if server.metrics != nil {
+		broker.hook = server.metrics
+	}
+
+	go broker.Run()
+
+	if server.mqttAddr != "" {
+		if mqttListenerFunc == nil {
+			log.Printf("hub: WithMQTTListener(%s) requires blank-importing the mqtt package", server.mqttAddr)
+		} else if stop, err := mqttListenerFunc(server.mqttAddr, broker); err != nil {
+			log.Printf("hub: mqtt listener on %s failed to start: %v", server.mqttAddr, err)
+		} else {
+			server.mqttStop = stop
+		}
+	}
+
+	router := mux.NewRouter()
+	router.Handle("/ws", negroni.New(
+		negroni.Wrap(broker),
+	))
+	router.HandleFunc("/topic/{name}", server.publishTopic).Methods(http.MethodPost)
+	router.HandleFunc("/topic/{name}", server.consumeTopic).Methods(http.MethodGet)
+	router.HandleFunc("/topics", server.listTopics).Methods(http.MethodGet)
+	if server.metrics != nil {
+		router.Handle("/metrics", server.metrics.Handler()).Methods(http.MethodGet)
+	}
+
+	server.Handler = router
+
+	return server
+}
+
+// Close stops the MQTT listener, if one was started with WithMQTTListener.
+func (s *BrokerServer) Close() error {
+	if s.mqttStop != nil {
+		return s.mqttStop()
+	}
+	return nil
+}
+
+// publishTopic handles POST /topic/{name}: the request body becomes the
+// message payload, and the assigned message ID and sequence are returned
+// as JSON. An X-Topic-TTL header (a Go duration string, e.g. "5m")
+// overrides the broker's default TTL for this topic.
+func (s *BrokerServer) publishTopic(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if raw := r.Header.Get("X-Topic-TTL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			http.Error(w, "invalid X-Topic-TTL: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	entry := s.broker.Hub.publishAndWait(PublishMessage{
+		Topic:       name,
+		Payload:     payload,
+		ttlOverride: ttl,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":  entry.ID,
+		"seq": entry.Seq,
+	})
+}
+
+// consumeTopic handles GET /topic/{name}: a long-poll that blocks until
+// the next message is published on the topic, the client disconnects, or
+// longPollTimeout elapses.
+func (s *BrokerServer) consumeTopic(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	client := &Client{ID: "consumer-" + newEventID(), send: make(chan []byte, 1)}
+
+	s.broker.register <- client
+	s.broker.subscribe <- &Subscription{Client: client, Topic: name}
+	defer func() { s.broker.unregister <- client }()
+
+	select {
+	case frame, ok := <-client.send:
+		if !ok {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(frame)
+	case <-time.After(longPollTimeout):
+		w.WriteHeader(http.StatusNoContent)
+	case <-r.Context().Done():
+	}
+}
+
+// listTopics handles GET /topics: a snapshot of every topic's name, TTL,
+// sequence and creation time.
+func (s *BrokerServer) listTopics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.broker.Hub.listTopics())
+}
@@ -0,0 +1,92 @@
+package hub
+
+import "time"
+
+// janitorInterval is how often Hub.Run checks for topics that have been
+// idle past their TTL. A var rather than a const so tests can shorten it
+// instead of waiting out the real interval.
+var janitorInterval = 10 * time.Second
+
+// topicMeta tracks bookkeeping for a topic that isn't tied to any one
+// subscriber: its publish sequence, when it was first seen, and how long
+// it may sit idle before the janitor reclaims it.
+type topicMeta struct {
+	created      time.Time
+	ttl          time.Duration
+	seq          uint64
+	lastActivity time.Time
+}
+
+// TopicInfo summarizes a topic for the GET /topics listing endpoint.
+type TopicInfo struct {
+	Name    string        `json:"name"`
+	TTL     time.Duration `json:"ttl"`
+	Seq     uint64        `json:"seq"`
+	Created time.Time     `json:"created"`
+}
+
+// touchTopicMeta records a publish on topic: it creates the topic's
+// metadata on first use, applies ttlOverride if set, and advances seq and
+// lastActivity. It's safe for concurrent use.
+func (h *Hub) touchTopicMeta(topic string, ttlOverride time.Duration, seq uint64) {
+	h.topicMu.Lock()
+	defer h.topicMu.Unlock()
+
+	meta, ok := h.topicMeta[topic]
+	if !ok {
+		meta = &topicMeta{created: time.Now(), ttl: h.defaultTTL}
+		h.topicMeta[topic] = meta
+	}
+	if ttlOverride > 0 {
+		meta.ttl = ttlOverride
+	}
+	meta.seq = seq
+	meta.lastActivity = time.Now()
+}
+
+// listTopics returns metadata for every topic the hub knows about. It's
+// safe for concurrent use.
+func (h *Hub) listTopics() []TopicInfo {
+	h.topicMu.Lock()
+	defer h.topicMu.Unlock()
+
+	out := make([]TopicInfo, 0, len(h.topicMeta))
+	for name, meta := range h.topicMeta {
+		ttl := meta.ttl
+		if ttl <= 0 {
+			ttl = h.defaultTTL
+		}
+		out = append(out, TopicInfo{Name: name, TTL: ttl, Seq: meta.seq, Created: meta.created})
+	}
+	return out
+}
+
+// expireTopics drops metadata and local bookkeeping for any topic with no
+// current subscribers whose TTL has elapsed since its last publish. The
+// topic's entries in the HistoryStore are not removed. A topic with no TTL
+// configured (the default) never expires.
+// Called only from Run, so h.topics needs no extra locking here.
+func (h *Hub) expireTopics(now time.Time) {
+	h.topicMu.Lock()
+	defer h.topicMu.Unlock()
+
+	for topic, meta := range h.topicMeta {
+		ttl := meta.ttl
+		if ttl <= 0 {
+			ttl = h.defaultTTL
+		}
+		if ttl <= 0 {
+			continue
+		}
+		if len(h.topics[topic]) > 0 {
+			continue
+		}
+		if now.Sub(meta.lastActivity) < ttl {
+			continue
+		}
+
+		delete(h.topicMeta, topic)
+		delete(h.topics, topic)
+		h.unsubscribeTransport(topic)
+	}
+}
@@ -0,0 +1,49 @@
+package hub
+
+// Unsub cancels a subscription created via Transport.Subscribe.
+type Unsub func()
+
+// Transport moves published messages between Hub instances. The default,
+// LocalTransport, keeps messages within this process exactly as before
+// Transport existed; NATSTransport and HTTPTransport instead fan messages
+// out to other websocket-hub processes so they share a logical topic
+// space, e.g. behind a load balancer.
+type Transport interface {
+	Connect() error
+	Disconnect() error
+
+	// Publish forwards payload to every other process subscribed to
+	// topic. It does not need to (and for LocalTransport, does not)
+	// deliver to this process's own clients; Hub.doEmit already does that.
+	Publish(topic string, payload []byte) error
+
+	// Subscribe registers handler to be called with the payload of every
+	// message another process publishes on topic. The returned Unsub
+	// cancels it.
+	Subscribe(topic string, handler func(payload []byte)) (Unsub, error)
+}
+
+// LocalTransport is the no-op default Transport: a single websocket-hub
+// process with nothing configured via WithTransport has no peers to fan
+// out to, so Publish and Subscribe simply do nothing. It exists so Hub
+// always has a non-nil Transport to call.
+type LocalTransport struct{}
+
+// NewLocalTransport creates a LocalTransport.
+func NewLocalTransport() *LocalTransport {
+	return &LocalTransport{}
+}
+
+// Connect implements Transport.
+func (t *LocalTransport) Connect() error { return nil }
+
+// Disconnect implements Transport.
+func (t *LocalTransport) Disconnect() error { return nil }
+
+// Publish implements Transport.
+func (t *LocalTransport) Publish(topic string, payload []byte) error { return nil }
+
+// Subscribe implements Transport.
+func (t *LocalTransport) Subscribe(topic string, handler func(payload []byte)) (Unsub, error) {
+	return func() {}, nil
+}
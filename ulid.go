@@ -0,0 +1,23 @@
+package hub
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// newEventID returns a ULID-style, lexically sortable event ID: a
+// millisecond timestamp followed by random entropy, hex-encoded so it can
+// be compared and persisted as a plain string.
+func newEventID() string {
+	var entropy [10]byte
+	_, _ = rand.Read(entropy[:])
+
+	ms := uint64(time.Now().UnixMilli())
+	ts := []byte{
+		byte(ms >> 40), byte(ms >> 32), byte(ms >> 24),
+		byte(ms >> 16), byte(ms >> 8), byte(ms),
+	}
+
+	return fmt.Sprintf("%x%x", ts, entropy)
+}
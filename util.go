@@ -0,0 +1,11 @@
+package hub
+
+// containsString reports whether s is present in list.
+func containsString(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}